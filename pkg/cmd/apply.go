@@ -0,0 +1,501 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/openapi3"
+	"k8s.io/klog/v2"
+	"k8s.io/kubectl/pkg/cmd/apply"
+	"k8s.io/kubectl/pkg/cmd/diff"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util"
+	"k8s.io/kubectl/pkg/util/openapi"
+)
+
+var (
+	applyLong = `Applies the input, then prunes the superseded generations of its real names.
+
+The input is applied the same way as "kubectl apply", client-side by default or
+server-side with --server-side. Then, the live generations of the real names in
+the input which are no longer used by the input are deleted once no live workload
+references them, waiting up to --prune-timeout for rollouts to switch over.
+
+With --dry-run, nothing is changed and the diff is shown instead, including the
+generations which would be pruned.
+
+With --plan, the input recorded in a plan saved by "kubectl realname-diff --save-plan"
+is applied instead. Nothing is applied if any live object compared in the plan has
+changed since the plan was created, so that the result is what was shown in the
+diff. The plan must be applied with --server-side if and only if the diff was made
+with it.`
+
+	applyExample = `  # Show what would be applied and pruned
+  kubectl realname-diff apply -k ./example --dry-run
+
+  # Apply the input and prune the superseded generations
+  kubectl realname-diff apply -k ./example
+
+  # Apply the input server-side without pruning
+  kubectl realname-diff apply -k ./example --server-side --prune=false
+
+  # Apply what was reviewed earlier
+  kubectl realname-diff -k ./example --save-plan plan.json
+  kubectl realname-diff apply --plan plan.json`
+)
+
+// pruneInterval is the interval to check whether the workloads have switched over
+// to the new generations.
+var pruneInterval = 2 * time.Second
+
+// crdEstablishedTimeout and crdEstablishedInterval are the length of time to wait for
+// the CustomResourceDefinitions applied from a plan to be established, and the
+// interval to check it.
+var (
+	crdEstablishedTimeout  = time.Minute
+	crdEstablishedInterval = time.Second
+)
+
+func NewCmdApply(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewApplyOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "apply -f FILENAME",
+		DisableFlagsInUseLine: true,
+		Short:                 "Apply the input and prune the superseded generations of its real names.",
+		Long:                  applyLong,
+		Example:               applyExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(options.Complete(factory, cmd))
+			cmdutil.CheckErr(validateArgs(cmd, args))
+			cmdutil.CheckErr(options.Run())
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&options.selector, "selector", "l", options.selector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.Flags().StringSliceVar(&options.matchLabels, "match-labels", options.matchLabels, "Label keys whose values must also match between the local and live objects when looking up by real name. (e.g. --match-labels app.kubernetes.io/instance)")
+	cmd.Flags().BoolVar(&options.prune, "prune", options.prune, "If true, delete the superseded generations of the real names in the input after applying it.")
+	cmd.Flags().DurationVar(&options.pruneTimeout, "prune-timeout", options.pruneTimeout, "The length of time to wait for the live workloads to stop referencing the superseded generations. The generations still referenced after that are not deleted.")
+	cmd.Flags().BoolVar(&options.dryRun, "dry-run", options.dryRun, "If true, only show the diff of what would be applied and pruned.")
+	cmd.Flags().StringVar(&options.planFile, "plan", options.planFile, "If set, apply the plan saved by \"kubectl realname-diff --save-plan\" instead of the input.")
+	cmd.Flags().StringVar(&options.targetSelectionStrategy, "target-selection-strategy", targetSelectionStrategyError, "Specifies the behavior of --dry-run when multiple diff targets are found. The value must be either \"error\" or \"latest\".")
+	cmdutil.AddFilenameOptionFlags(cmd, &options.filenameOptions, "Contains the configuration to apply")
+	cmdutil.AddServerSideApplyFlags(cmd)
+	cmdutil.AddFieldManagerFlagVar(cmd, &options.fieldManager, apply.FieldManagerClientSideApply)
+
+	return cmd
+}
+
+type ApplyOptions struct {
+	filenameOptions resource.FilenameOptions
+
+	serverSideApply bool
+	fieldManager    string
+	forceConflicts  bool
+
+	selector                string
+	matchLabels             []string
+	prune                   bool
+	pruneTimeout            time.Duration
+	dryRun                  bool
+	planFile                string
+	targetSelectionStrategy string
+
+	openAPIGetter    openapi.OpenAPIResourcesGetter
+	openAPIV3Root    openapi3.Root
+	dynamicClient    dynamic.Interface
+	cmdNamespace     string
+	enforceNamespace bool
+	builder          *resource.Builder
+	mapper           meta.RESTMapper
+	clientForMapping func(*meta.RESTMapping) (resource.RESTClient, error)
+	plan             *plan
+
+	// diffOptions shows the diff instead of applying with --dry-run.
+	diffOptions *RealnameDiffOptions
+
+	genericclioptions.IOStreams
+}
+
+func NewApplyOptions(streams genericclioptions.IOStreams) *ApplyOptions {
+	return &ApplyOptions{
+		prune:        true,
+		pruneTimeout: 5 * time.Minute,
+		IOStreams:    streams,
+	}
+}
+
+func (o *ApplyOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command) error {
+	var err error
+
+	if len(o.planFile) > 0 {
+		if len(o.filenameOptions.Filenames) > 0 || len(o.filenameOptions.Kustomize) > 0 {
+			return fmt.Errorf("--plan cannot be used with -f or -k")
+		}
+		if o.dryRun {
+			return fmt.Errorf("--plan cannot be used with --dry-run")
+		}
+
+		o.plan, err = loadPlan(o.planFile)
+		if err != nil {
+			return err
+		}
+		o.mapper, err = factory.ToRESTMapper()
+		if err != nil {
+			return err
+		}
+		o.clientForMapping = factory.UnstructuredClientForMapping
+	} else {
+		err = o.filenameOptions.RequireFilenameOrKustomize()
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.dryRun {
+		o.diffOptions = NewRealnameDiffOptions(o.IOStreams)
+		o.diffOptions.filenameOptions = o.filenameOptions
+		o.diffOptions.selector = o.selector
+		o.diffOptions.matchLabels = o.matchLabels
+		o.diffOptions.targetSelectionStrategy = o.targetSelectionStrategy
+		o.diffOptions.showOrphans = o.prune
+		o.diffOptions.concurrency = 1
+		return o.diffOptions.Complete(factory, cmd)
+	}
+
+	o.serverSideApply = cmdutil.GetServerSideApplyFlag(cmd)
+	o.fieldManager = apply.GetApplyFieldManagerFlag(cmd, o.serverSideApply)
+	o.forceConflicts = cmdutil.GetForceConflictsFlag(cmd)
+	if o.forceConflicts && !o.serverSideApply {
+		return fmt.Errorf("--force-conflicts only works with --server-side")
+	}
+	if o.plan != nil {
+		if err := o.plan.checkMode(o.serverSideApply); err != nil {
+			return err
+		}
+	}
+
+	if !o.serverSideApply {
+		o.openAPIGetter = factory
+		if !cmdutil.OpenAPIV3Patch.IsDisabled() {
+			openAPIV3Client, err := factory.OpenAPIV3Client()
+			if err == nil {
+				o.openAPIV3Root = openapi3.NewRoot(openAPIV3Client)
+			} else {
+				klog.V(4).Infof("warning: OpenAPI V3 Patch is enabled but is unable to be loaded. Will fall back to OpenAPI V2")
+			}
+		}
+	}
+
+	o.dynamicClient, err = factory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	o.cmdNamespace, o.enforceNamespace, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.builder = factory.NewBuilder()
+
+	return nil
+}
+
+// applyObject applies the local object of the info, and returns how it was applied.
+// info.Object is replaced with the applied object. If resourceVersion is set, the
+// live object is updated only if it still has the resourceVersion.
+func (o *ApplyOptions) applyObject(info *resource.Info, resourceVersion string) (string, error) {
+	helper := resource.NewHelper(info.Client, info.Mapping).
+		WithFieldManager(o.fieldManager)
+
+	if o.serverSideApply {
+		local := info.Object.(*unstructured.Unstructured).DeepCopy()
+		local.SetResourceVersion(resourceVersion)
+		data, err := runtime.Encode(unstructured.UnstructuredJSONScheme, local)
+		if err != nil {
+			return "", err
+		}
+		obj, err := helper.Patch(info.Namespace, info.Name, types.ApplyPatchType, data, &metav1.PatchOptions{
+			Force: &o.forceConflicts,
+		})
+		if err != nil {
+			return "", err
+		}
+		return "serverside-applied", info.Refresh(obj, true)
+	}
+
+	modified, err := util.GetModifiedConfiguration(info.Object, true, unstructured.UnstructuredJSONScheme)
+	if err != nil {
+		return "", err
+	}
+
+	if err := info.Get(); err != nil {
+		if !isNotFound(err) {
+			return "", err
+		}
+
+		// Objects with a new name, such as a new generation of a real name, are created.
+		if err := util.CreateApplyAnnotation(info.Object, unstructured.UnstructuredJSONScheme); err != nil {
+			return "", err
+		}
+		obj, err := helper.Create(info.Namespace, true, info.Object)
+		if err != nil {
+			return "", err
+		}
+		return "created", info.Refresh(obj, true)
+	}
+
+	// This is using the patcher from apply, to keep the same behavior.
+	patcher := &apply.Patcher{
+		Mapping:       info.Mapping,
+		Helper:        helper,
+		Overwrite:     true,
+		BackOff:       clockwork.NewRealClock(),
+		OpenAPIGetter: o.openAPIGetter,
+		OpenAPIV3Root: o.openAPIV3Root,
+		Retries:       maxRetries,
+	}
+	if len(resourceVersion) > 0 {
+		patcher.ResourceVersion = &resourceVersion
+	}
+	patch, obj, err := patcher.Patch(info.Object, modified, info.Source, info.Namespace, info.Name, o.ErrOut)
+	if err != nil {
+		return "", err
+	}
+	if string(patch) == "{}" {
+		return "unchanged", nil
+	}
+	return "configured", info.Refresh(obj, true)
+}
+
+// pruneSuperseded deletes the superseded generations once no live workload references
+// them, waiting up to the prune timeout. The ones still referenced are reported.
+func (o *ApplyOptions) pruneSuperseded(tracker *orphanTracker, lookup *realnameLookup) error {
+	deadline := time.Now().Add(o.pruneTimeout)
+	pruned := map[string]bool{}
+	for {
+		superseded, err := tracker.superseded(lookup, o.dynamicClient)
+		if err != nil {
+			return err
+		}
+
+		var waiting []orphan
+		for _, g := range superseded {
+			name := diff.InfoObject{Info: g.info}.Name()
+			if pruned[name] {
+				continue
+			}
+			if len(g.referencedBy) > 0 {
+				waiting = append(waiting, g)
+				continue
+			}
+
+			if err := deleteGeneration(g); err != nil {
+				return err
+			}
+			pruned[name] = true
+			fmt.Fprintf(o.Out, "%s/%s pruned\n", strings.ToLower(g.info.Mapping.GroupVersionKind.Kind), g.info.Name)
+		}
+
+		if len(waiting) == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			for _, g := range waiting {
+				fmt.Fprintf(o.ErrOut, "Skipped pruning %s/%s: still referenced by %s\n",
+					strings.ToLower(g.info.Mapping.GroupVersionKind.Kind), g.info.Name, strings.Join(g.referencedBy, ","))
+			}
+			return nil
+		}
+		time.Sleep(pruneInterval)
+	}
+}
+
+func (o *ApplyOptions) Run() error {
+	if o.dryRun {
+		err := o.diffOptions.Run()
+		// The diff exits with 1 when there are differences, which is not an error here.
+		if diffError(err) != nil {
+			return nil
+		}
+		return err
+	}
+
+	lookup := &realnameLookup{
+		matchLabels: o.matchLabels,
+		selector:    o.selector,
+	}
+	// The live workloads in the input are replaced by the applied ones, so they are
+	// considered when pruning.
+	tracker := newOrphanTracker(false)
+
+	applyInfo := func(info *resource.Info, resourceVersion string) error {
+		if o.prune {
+			if err := tracker.add(info, info.Object.DeepCopyObject().(*unstructured.Unstructured)); err != nil {
+				return err
+			}
+		}
+
+		operation, err := o.applyObject(info, resourceVersion)
+		if err != nil {
+			return cmdutil.AddSourceToErr("applying", info.Source, err)
+		}
+		fmt.Fprintf(o.Out, "%s/%s %s\n", strings.ToLower(info.Mapping.GroupVersionKind.Kind), info.Name, operation)
+		return nil
+	}
+
+	if o.plan != nil {
+		if err := o.applyPlan(applyInfo); err != nil {
+			return err
+		}
+	} else {
+		r := o.builder.
+			Unstructured().
+			NamespaceParam(o.cmdNamespace).DefaultNamespace().
+			FilenameParam(o.enforceNamespace, &o.filenameOptions).
+			LabelSelectorParam(o.selector).
+			Flatten().
+			Do()
+		if err := r.Err(); err != nil {
+			return err
+		}
+
+		err := r.Visit(func(info *resource.Info, err error) error {
+			if err != nil {
+				return err
+			}
+			return applyInfo(info, "")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !o.prune {
+		return nil
+	}
+	return o.pruneSuperseded(tracker, lookup)
+}
+
+// applyPlan applies the local objects in the plan after verifying that none of the
+// live objects compared in the plan has changed. Custom resources whose kinds are
+// defined by CustomResourceDefinitions in the plan are applied last, once the
+// definitions are established.
+func (o *ApplyOptions) applyPlan(applyInfo func(info *resource.Info, resourceVersion string) error) error {
+	crds := map[schema.GroupKind]crdKind{}
+	for _, entry := range o.plan.Objects {
+		if gk, kind, ok := crdKindOf(entry.Local); ok {
+			crds[gk] = kind
+		}
+	}
+
+	mapper := &pendingKindMapper{RESTMapper: o.mapper}
+	infos := make([]*resource.Info, len(o.plan.Objects))
+	crdInfos := map[schema.GroupKind]*resource.Info{}
+	var ordered, notInstalled []int
+	for i, entry := range o.plan.Objects {
+		local := entry.Local.DeepCopy()
+		gvk := local.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return err
+		}
+		client, err := o.clientForMapping(mapping)
+		if err != nil {
+			return err
+		}
+
+		infos[i] = &resource.Info{
+			Client:    client,
+			Mapping:   mapping,
+			Namespace: local.GetNamespace(),
+			Name:      local.GetName(),
+			Source:    o.planFile,
+			Object:    local,
+		}
+		if gk, _, ok := crdKindOf(local); ok {
+			crdInfos[gk] = infos[i]
+		}
+		if mappingErr := mapper.pendingErr(gvk.GroupKind()); mappingErr != nil {
+			if err := resolveNotInstalled(infos[i], crds, mappingErr); err != nil {
+				return err
+			}
+			notInstalled = append(notInstalled, i)
+		} else {
+			ordered = append(ordered, i)
+		}
+
+		if err := entry.verify(infos[i]); err != nil {
+			return fmt.Errorf("%w, run the diff again to create a new plan", err)
+		}
+	}
+
+	established := map[schema.GroupKind]bool{}
+	for _, i := range append(ordered, notInstalled...) {
+		entry := o.plan.Objects[i]
+		if gk := infos[i].Mapping.GroupVersionKind.GroupKind(); mapper.pendingErr(gk) != nil && !established[gk] {
+			if err := waitForEstablished(crdInfos[gk]); err != nil {
+				return err
+			}
+			established[gk] = true
+		}
+
+		// Objects compared with a live object of the same name are updated only if it
+		// is still the one in the plan. Objects compared with a live object of another
+		// name are created, which cannot be conditioned on the version of the other
+		// object, so it is verified again right before creating them.
+		var resourceVersion string
+		if entry.renamed() {
+			if err := entry.verify(infos[i]); err != nil {
+				return fmt.Errorf("%w, run the diff again to create a new plan", err)
+			}
+		} else {
+			resourceVersion = entry.ResourceVersion
+		}
+		if err := applyInfo(infos[i], resourceVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForEstablished waits up to crdEstablishedTimeout for the CustomResourceDefinition
+// of the info to be established, so that its custom resources can be created.
+func waitForEstablished(info *resource.Info) error {
+	helper := resource.NewHelper(info.Client, info.Mapping)
+	deadline := time.Now().Add(crdEstablishedTimeout)
+	for {
+		obj, err := helper.Get(info.Namespace, info.Name)
+		if err != nil {
+			return err
+		}
+		conditions, _, _ := unstructured.NestedSlice(obj.(*unstructured.Unstructured).Object, "status", "conditions")
+		for _, c := range conditions {
+			if condition, ok := c.(map[string]interface{}); ok && condition["type"] == "Established" && condition["status"] == "True" {
+				return nil
+			}
+		}
+
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("customresourcedefinition/%s is not established after %v", info.Name, crdEstablishedTimeout)
+		}
+		time.Sleep(crdEstablishedInterval)
+	}
+}
@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/rest/fake"
+)
+
+// Test_ApplyOptions_pruneSuperseded tests that only the generations no longer referenced by live workloads are deleted
+func Test_ApplyOptions_pruneSuperseded(t *testing.T) {
+	scope := indexKey{resource: configMapMapping.Resource, namespace: "default"}
+	lookup := newIndexedLookup(scope,
+		newLiveMetadata("nginx-conf-new", "nginx-conf"),
+		newLiveMetadata("nginx-conf-old", "nginx-conf"),
+		newLiveMetadata("nginx-conf-older", "nginx-conf"),
+	)
+
+	// The old ReplicaSet of the Deployment still runs pods referencing nginx-conf-old
+	replicaSet := newWorkload("apps/v1", "ReplicaSet", "nginx-abc", newPodSpecWithConfigMapVolume("nginx-conf-old"))
+	_ = unstructured.SetNestedField(replicaSet.Object, int64(1), "spec", "replicas")
+	dynamicClient := newDynamicClient(replicaSet)
+
+	var deletes []string
+	client := &fake.RESTClient{
+		NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+		GroupVersion:         corev1.SchemeGroupVersion,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			if req.Method == http.MethodDelete {
+				deletes = append(deletes, req.URL.Path)
+			}
+			header := http.Header{"Content-Type": []string{runtime.ContentTypeJSON}}
+			body := `{"kind":"Status","apiVersion":"v1","status":"Success"}`
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+		}),
+	}
+
+	local := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now())
+	tracker := newOrphanTracker(false)
+	info := &resource.Info{Client: client, Mapping: configMapMapping, Namespace: "default", Name: local.GetName(), Object: local}
+	if err := tracker.add(info, local); err != nil {
+		t.Fatalf("add() returned error: %v", err)
+	}
+
+	streams, _, out, errOut := genericclioptions.NewTestIOStreams()
+	o := NewApplyOptions(streams)
+	o.dynamicClient = dynamicClient
+	o.pruneTimeout = 0
+
+	if err := o.pruneSuperseded(tracker, lookup); err != nil {
+		t.Fatalf("pruneSuperseded() returned error: %v", err)
+	}
+
+	if expected := []string{"/namespaces/default/configmaps/nginx-conf-older"}; !reflect.DeepEqual(deletes, expected) {
+		t.Errorf("deleted %v, want %v", deletes, expected)
+	}
+	if expected := "configmap/nginx-conf-older pruned\n"; out.String() != expected {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	if !bytes.Contains(errOut.Bytes(), []byte("Skipped pruning configmap/nginx-conf-old: still referenced by ReplicaSet/nginx-abc")) {
+		t.Errorf("expected the referenced generation to be reported, got %q", errOut.String())
+	}
+}
+
+// newPlanClient creates a fake REST client serving the ConfigMaps with the resourceVersions, and recording the requests
+func newPlanClient(live map[string]string, requests *[]string, bodies map[string]string) *fake.RESTClient {
+	return &fake.RESTClient{
+		NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+		GroupVersion:         corev1.SchemeGroupVersion,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			*requests = append(*requests, req.Method+" "+req.URL.Path)
+			header := http.Header{"Content-Type": []string{runtime.ContentTypeJSON}}
+			if req.Body != nil {
+				data, _ := io.ReadAll(req.Body)
+				bodies[req.Method] = string(data)
+				if req.Method == http.MethodPost {
+					return &http.Response{StatusCode: http.StatusCreated, Header: header, Body: io.NopCloser(bytes.NewReader(data))}, nil
+				}
+			}
+
+			name := strings.TrimPrefix(req.URL.Path, "/namespaces/default/configmaps/")
+			rv, ok := live[name]
+			if !ok {
+				body := `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`
+				return &http.Response{StatusCode: http.StatusNotFound, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+			}
+			body := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"` + name + `","namespace":"default","resourceVersion":"` + rv + `"},"data":{"test":"live"}}`
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+		}),
+	}
+}
+
+// Test_ApplyOptions_applyPlan tests applying the local objects in the plan only if the live objects have not changed
+func Test_ApplyOptions_applyPlan(t *testing.T) {
+	newMerged := func(name string) *unstructured.Unstructured {
+		merged := newConfigMapWithRealname(name, "nginx-conf", time.Now())
+		_ = unstructured.SetNestedField(merged.Object, "defaulted", "data", "default")
+		merged.SetFinalizers([]string{"example.com/finalizer"})
+		merged.SetUID("uid")
+		merged.SetResourceVersion("42")
+		return merged
+	}
+
+	tests := []struct {
+		name             string
+		entry            planEntry
+		live             map[string]string
+		expectedRequests []string
+		expectedBody     map[string]string
+		expectedError    string
+	}{
+		{
+			name:  "updated with the resourceVersion",
+			entry: planEntry{Local: newConfigMapWithRealname("nginx-conf", "nginx-conf", time.Now()), Merged: newMerged("nginx-conf"), LiveName: "nginx-conf", ResourceVersion: "42"},
+			live:  map[string]string{"nginx-conf": "42"},
+			expectedRequests: []string{
+				"GET /namespaces/default/configmaps/nginx-conf",
+				"GET /namespaces/default/configmaps/nginx-conf",
+				"PATCH /namespaces/default/configmaps/nginx-conf",
+			},
+			expectedBody: map[string]string{http.MethodPatch: `"resourceVersion":"42"`},
+		},
+		{
+			name:  "new generation created after verified again",
+			entry: planEntry{Local: newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now()), Merged: newMerged("nginx-conf-new"), LiveName: "nginx-conf-old", ResourceVersion: "42"},
+			live:  map[string]string{"nginx-conf-old": "42"},
+			expectedRequests: []string{
+				"GET /namespaces/default/configmaps/nginx-conf-new",
+				"GET /namespaces/default/configmaps/nginx-conf-old",
+				"GET /namespaces/default/configmaps/nginx-conf-new",
+				"GET /namespaces/default/configmaps/nginx-conf-old",
+				"GET /namespaces/default/configmaps/nginx-conf-new",
+				"POST /namespaces/default/configmaps",
+			},
+			expectedBody: map[string]string{http.MethodPost: `"test":"data"`},
+		},
+		{
+			name:  "refused when the live object has changed",
+			entry: planEntry{Local: newConfigMapWithRealname("nginx-conf", "nginx-conf", time.Now()), Merged: newMerged("nginx-conf"), LiveName: "nginx-conf", ResourceVersion: "42"},
+			live:  map[string]string{"nginx-conf": "43"},
+			expectedRequests: []string{
+				"GET /namespaces/default/configmaps/nginx-conf",
+			},
+			expectedError: "configmap/nginx-conf has changed since the plan was created: resourceVersion is 43, planned 42, run the diff again to create a new plan",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []string
+			bodies := map[string]string{}
+			client := newPlanClient(tt.live, &requests, bodies)
+
+			streams, _, _, _ := genericclioptions.NewTestIOStreams()
+			o := NewApplyOptions(streams)
+			o.plan = &plan{Objects: []planEntry{tt.entry}}
+			mapper := meta.NewDefaultRESTMapper(nil)
+			mapper.Add(configMapMapping.GroupVersionKind, meta.RESTScopeNamespace)
+			o.mapper = mapper
+			o.clientForMapping = func(*meta.RESTMapping) (resource.RESTClient, error) {
+				return client, nil
+			}
+
+			err := o.applyPlan(func(info *resource.Info, resourceVersion string) error {
+				_, err := o.applyObject(info, resourceVersion)
+				return err
+			})
+			if len(tt.expectedError) > 0 {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("applyPlan() error = %v, want %q", err, tt.expectedError)
+				}
+			} else if err != nil {
+				t.Fatalf("applyPlan() returned error: %v", err)
+			}
+
+			if !reflect.DeepEqual(requests, tt.expectedRequests) {
+				t.Errorf("requests = %v, want %v", requests, tt.expectedRequests)
+			}
+			for method, expected := range tt.expectedBody {
+				if !strings.Contains(bodies[method], expected) {
+					t.Errorf("expected the %s body to contain %s, got %s", method, expected, bodies[method])
+				}
+				for _, merged := range []string{`"uid"`, "defaulted", "finalizer"} {
+					if strings.Contains(bodies[method], merged) {
+						t.Errorf("expected the local object to be applied instead of the merged one, got %s", bodies[method])
+					}
+				}
+			}
+		})
+	}
+}
+
+// Test_ApplyOptions_applyPlan_customResources tests creating the custom resources in the plan once their CustomResourceDefinition is established
+func Test_ApplyOptions_applyPlan_customResources(t *testing.T) {
+	crdEstablishedInterval = 0
+	defer func() { crdEstablishedInterval = time.Second }()
+
+	crd := newCRD("example.com", "Widget", "widgets", "Namespaced", "v1")
+	crd.SetName("widgets.example.com")
+	widget := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "foo", "namespace": "default"},
+	}}
+
+	var requests []string
+	stored := map[string][]byte{}
+	client := &fake.RESTClient{
+		NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			requests = append(requests, req.Method+" "+req.URL.Path)
+			header := http.Header{"Content-Type": []string{runtime.ContentTypeJSON}}
+			if req.Method == http.MethodPost {
+				obj := &unstructured.Unstructured{}
+				data, _ := io.ReadAll(req.Body)
+				if err := obj.UnmarshalJSON(data); err != nil {
+					return nil, err
+				}
+				_ = unstructured.SetNestedSlice(obj.Object, []interface{}{
+					map[string]interface{}{"type": "Established", "status": "True"},
+				}, "status", "conditions")
+				data, _ = obj.MarshalJSON()
+				stored[req.URL.Path+"/"+obj.GetName()] = data
+				return &http.Response{StatusCode: http.StatusCreated, Header: header, Body: io.NopCloser(bytes.NewReader(data))}, nil
+			}
+
+			data, ok := stored[req.URL.Path]
+			if !ok {
+				body := `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`
+				return &http.Response{StatusCode: http.StatusNotFound, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(data))}, nil
+		}),
+	}
+
+	streams, _, _, _ := genericclioptions.NewTestIOStreams()
+	o := NewApplyOptions(streams)
+	// The custom resource comes first, but is created after the definition.
+	o.plan = &plan{Objects: []planEntry{{Local: widget}, {Local: crd}}}
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(crdGroupKind.WithVersion("v1"), meta.RESTScopeRoot)
+	o.mapper = mapper
+	o.clientForMapping = func(*meta.RESTMapping) (resource.RESTClient, error) {
+		return client, nil
+	}
+
+	err := o.applyPlan(func(info *resource.Info, resourceVersion string) error {
+		_, err := o.applyObject(info, resourceVersion)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("applyPlan() returned error: %v", err)
+	}
+
+	expected := []string{
+		"GET /namespaces/default/widgets/foo",
+		"GET /customresourcedefinitions/widgets.example.com",
+		"GET /customresourcedefinitions/widgets.example.com",
+		"POST /customresourcedefinitions",
+		"GET /customresourcedefinitions/widgets.example.com",
+		"GET /namespaces/default/widgets/foo",
+		"POST /namespaces/default/widgets",
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("requests = %v, want %v", requests, expected)
+	}
+}
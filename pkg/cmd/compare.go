@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/kubectl/pkg/cmd/diff"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+// comparedFields are the fields which differ between clusters without changes to the
+// configuration, removed in addition to the volatile fields when comparing the live
+// objects of two clusters.
+var comparedFields = [][]string{
+	{"metadata", "uid"},
+	{"metadata", "creationTimestamp"},
+}
+
+// newContextFactory returns the factory for the context in the kubeconfig used by
+// the command. The namespace and the request timeout given by the command are also
+// used.
+func newContextFactory(cmd *cobra.Command, context string) cmdutil.Factory {
+	kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	configFlags.KubeConfig = &kubeconfig
+	configFlags.Context = &context
+	if cmd.Flags().Changed("namespace") {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		configFlags.Namespace = &namespace
+	}
+	if cmd.Flags().Changed("request-timeout") {
+		timeout, _ := cmd.Flags().GetString("request-timeout")
+		configFlags.Timeout = &timeout
+	}
+	return cmdutil.NewFactory(configFlags)
+}
+
+// normalizeForComparison returns a copy of the live object without the fields
+// specific to the cluster, so that the objects of two clusters can be compared. The
+// 'last-applied-configuration' annotation is deleted as in the diff of renamed
+// objects.
+func normalizeForComparison(live *unstructured.Unstructured) *unstructured.Unstructured {
+	obj := live.DeepCopy()
+	deleteLastApplied(obj)
+	for _, field := range append(volatileFields, comparedFields...) {
+		unstructured.RemoveNestedField(obj.Object, field...)
+	}
+
+	refs := obj.GetOwnerReferences()
+	for i := range refs {
+		refs[i].UID = ""
+	}
+	if len(refs) > 0 {
+		obj.SetOwnerReferences(refs)
+	}
+	return obj
+}
+
+// getCompared looks up the live counterpart of the local object in the scope of the
+// info, and returns it normalized for comparison, or nil if there is none.
+func getCompared(lookup *realnameLookup, info *resource.Info, local *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	info.Object = local.DeepCopy()
+
+	var err error
+	if on := realName(local); len(on) > 0 {
+		err = lookup.getWithRealName(info, local, on)
+	} else {
+		err = lookup.get(info, info.Name)
+	}
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return normalizeForComparison(info.Object.(*unstructured.Unstructured)), nil
+}
+
+// runCompareContext diffs the live objects of the input in the current context with
+// those in the --compare-context one.
+func (o *RealnameDiffOptions) runCompareContext() error {
+	// The differ only knows these versions, which are the current and the other
+	// contexts.
+	differ, err := diff.NewDiffer("LIVE", "MERGED")
+	if err != nil {
+		return err
+	}
+	defer differ.TearDown()
+
+	fmt.Fprintf(
+		o.diffProgram.ErrOut,
+		"Diffing the live objects in the current context (LIVE) with those in the context %q (MERGED)\n",
+		o.compareContext,
+	)
+
+	newLookup := func() *realnameLookup {
+		lookup := &realnameLookup{
+			strategy:      o.targetSelectionStrategy,
+			matchLabels:   o.matchLabels,
+			allCandidates: o.allCandidates,
+			selector:      o.selector,
+		}
+		if o.verbose {
+			lookup.verboseOut = o.diffProgram.ErrOut
+		}
+		return lookup
+	}
+	lookup, otherLookup := newLookup(), newLookup()
+
+	r := o.builder.
+		Unstructured().
+		VisitorConcurrency(o.concurrency).
+		NamespaceParam(o.cmdNamespace).DefaultNamespace().
+		FilenameParam(o.enforceNamespace, &o.filenameOptions).
+		LabelSelectorParam(o.selector).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	// The input is read at once to find the duplicate real names before looking up
+	// any live objects, as in the diff against the current context.
+	infos, err := r.Infos()
+	if err != nil {
+		return err
+	}
+	if err := checkDuplicateRealnames(infos, o.allowDuplicateRealnames, o.diffProgram.ErrOut); err != nil {
+		return err
+	}
+
+	printer := diff.Printer{}
+	compare := func(info *resource.Info) error {
+		local := info.Object.(*unstructured.Unstructured).DeepCopy()
+		gvk := info.Mapping.GroupVersionKind
+
+		var from *unstructured.Unstructured
+		if o.mapper.pendingErr(gvk.GroupKind()) == nil {
+			from, err = getCompared(lookup, info, local)
+			if err != nil {
+				return err
+			}
+		}
+
+		var to *unstructured.Unstructured
+		mapping, err := o.otherMapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil && !meta.IsNoMatchError(err) {
+			return err
+		}
+		if err == nil {
+			client, err := o.otherFactory.UnstructuredClientForMapping(mapping)
+			if err != nil {
+				return err
+			}
+			other := &resource.Info{
+				Client:    client,
+				Mapping:   mapping,
+				Namespace: info.Namespace,
+				Name:      info.Name,
+			}
+			to, err = getCompared(otherLookup, other, local)
+			if err != nil {
+				return err
+			}
+		}
+
+		name := diff.InfoObject{Info: info}.Name()
+		switch {
+		case from == nil && to == nil:
+			return nil
+		case to == nil:
+			return printDeleted(differ, name, from, printer, o.showManagedFields)
+		default:
+			return differ.Diff(pairObject{from: from, to: to, name: name}, printer, o.showManagedFields)
+		}
+	}
+	for _, info := range infos {
+		if err := compare(info); err != nil {
+			return err
+		}
+	}
+
+	return differ.Run(o.diffProgram)
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/rest/fake"
+)
+
+// Test_normalizeForComparison tests removing the fields specific to each cluster
+func Test_normalizeForComparison(t *testing.T) {
+	live := newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", time.Now())
+	live.SetUID("live-uid")
+	live.SetResourceVersion("42")
+	live.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"})
+	live.SetOwnerReferences([]metav1.OwnerReference{{APIVersion: "v1", Kind: "Secret", Name: "owner", UID: "owner-uid"}})
+
+	obj := normalizeForComparison(live)
+	if obj.GetUID() != "" || obj.GetResourceVersion() != "" || obj.GetCreationTimestamp() != (metav1.Time{}) {
+		t.Errorf("expected the fields specific to the cluster to be removed, got %v", obj.Object["metadata"])
+	}
+	if obj.GetAnnotations() != nil {
+		t.Errorf("expected the 'last-applied-configuration' annotation to be removed, got %v", obj.GetAnnotations())
+	}
+	if refs := obj.GetOwnerReferences(); len(refs) != 1 || refs[0].UID != "" || refs[0].Name != "owner" {
+		t.Errorf("expected the owner reference without uid, got %v", refs)
+	}
+	if obj.GetName() != "nginx-conf-abc" || realName(obj) != "nginx-conf" {
+		t.Errorf("expected the name and labels to be kept, got %v", obj.Object["metadata"])
+	}
+	if live.GetUID() != "live-uid" {
+		t.Errorf("expected the live object not to be modified")
+	}
+}
+
+// Test_getCompared tests looking up the live counterpart in a cluster by real name
+func Test_getCompared(t *testing.T) {
+	tests := []struct {
+		name     string
+		live     string
+		expected string
+	}{
+		{
+			name:     "found by real name",
+			live:     "nginx-conf-old",
+			expected: "nginx-conf-old",
+		},
+		{
+			name: "not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fake.RESTClient{
+				NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+				GroupVersion:         corev1.SchemeGroupVersion,
+				Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+					header := http.Header{"Content-Type": []string{runtime.ContentTypeJSON}}
+					metadata := `{"name":"` + tt.live + `","namespace":"default","uid":"other-uid","labels":{"realname-diff/realname":"nginx-conf"}}`
+					if req.URL.Path == "/namespaces/default/configmaps" {
+						items := ""
+						if len(tt.live) > 0 {
+							items = `{"metadata":` + metadata + `}`
+						}
+						body := `{"kind":"PartialObjectMetadataList","apiVersion":"meta.k8s.io/v1","metadata":{},"items":[` + items + `]}`
+						return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+					}
+					if len(tt.live) == 0 || req.URL.Path != "/namespaces/default/configmaps/"+tt.live {
+						body := `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`
+						return &http.Response{StatusCode: http.StatusNotFound, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+					}
+					body := `{"apiVersion":"v1","kind":"ConfigMap","metadata":` + metadata + `}`
+					return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+				}),
+			}
+			local := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now())
+			info := &resource.Info{Client: client, Mapping: configMapMapping, Namespace: "default", Name: local.GetName()}
+
+			obj, err := getCompared(&realnameLookup{strategy: targetSelectionStrategyError}, info, local)
+			if err != nil {
+				t.Fatalf("getCompared() returned error: %v", err)
+			}
+			if len(tt.expected) == 0 {
+				if obj != nil {
+					t.Errorf("expected nil, got %v", obj)
+				}
+				return
+			}
+			if obj.GetName() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, obj.GetName())
+			}
+			if obj.GetUID() != "" {
+				t.Errorf("expected the object to be normalized, got uid %q", obj.GetUID())
+			}
+		})
+	}
+}
+
+// Test_RealnameDiffOptions_runCompareContext_duplicates tests rejecting duplicate real names before comparing the contexts
+func Test_RealnameDiffOptions_runCompareContext_duplicates(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "local.yaml")
+	local := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-conf-a
+  namespace: default
+  labels:
+    realname-diff/realname: nginx-conf
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-conf-b
+  namespace: default
+  labels:
+    realname-diff/realname: nginx-conf
+`
+	if err := os.WriteFile(filename, []byte(local), 0644); err != nil {
+		t.Fatalf("failed to write the input: %v", err)
+	}
+
+	streams, _, out, _ := genericclioptions.NewTestIOStreams()
+	o := NewRealnameDiffOptions(streams)
+	o.builder = resource.NewLocalBuilder()
+	o.filenameOptions = resource.FilenameOptions{Filenames: []string{filename}}
+	o.compareContext = "staging"
+
+	err := o.Run()
+	expected := `multiple ConfigMap objects with realname=nginx-conf in namespace "default": nginx-conf-a, nginx-conf-b`
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected the duplicate real names to be rejected, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no diff, got %q", out.String())
+	}
+}
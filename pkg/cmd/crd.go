@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+var crdGroupKind = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+
+// pendingKindMapper is a RESTMapper which maps kinds not installed in the cluster to
+// a guessed mapping instead of failing, so that custom resources can be visited
+// even if their CustomResourceDefinitions are in the same input. The kinds mapped
+// this way are recorded with the original error, and must be resolved against the
+// CustomResourceDefinitions in the input after visiting.
+type pendingKindMapper struct {
+	meta.RESTMapper
+
+	mu      sync.Mutex
+	pending map[schema.GroupKind]error
+}
+
+func (m *pendingKindMapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	mapping, err := m.RESTMapper.RESTMapping(gk, versions...)
+	if !meta.IsNoMatchError(err) || len(versions) == 0 {
+		return mapping, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending == nil {
+		m.pending = map[schema.GroupKind]error{}
+	}
+	m.pending[gk] = err
+
+	gvk := gk.WithVersion(versions[0])
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	return &meta.RESTMapping{
+		Resource:         plural,
+		GroupVersionKind: gvk,
+		Scope:            meta.RESTScopeNamespace,
+	}, nil
+}
+
+// pendingErr returns the mapping error of the kind if it is not installed in the
+// cluster, nil otherwise.
+func (m *pendingKindMapper) pendingErr(gk schema.GroupKind) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pending[gk]
+}
+
+// pendingKindGetter is a RESTClientGetter which returns the pendingKindMapper as
+// its RESTMapper.
+type pendingKindGetter struct {
+	genericclioptions.RESTClientGetter
+
+	mapper *pendingKindMapper
+}
+
+func (g *pendingKindGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	return g.mapper, nil
+}
+
+// newPendingKindBuilder returns a resource builder which visits objects of kinds not
+// installed in the cluster with the returned pendingKindMapper.
+func newPendingKindBuilder(getter genericclioptions.RESTClientGetter) (*resource.Builder, *pendingKindMapper, error) {
+	restMapper, err := getter.ToRESTMapper()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mapper := &pendingKindMapper{RESTMapper: restMapper}
+	return resource.NewBuilder(&pendingKindGetter{RESTClientGetter: getter, mapper: mapper}), mapper, nil
+}
+
+// crdKind holds what a CustomResourceDefinition in the input defines.
+type crdKind struct {
+	resource   string
+	namespaced bool
+	versions   map[string]bool
+}
+
+// crdKindOf returns the kind defined by the CustomResourceDefinition object. ok is
+// false if the object is not a CustomResourceDefinition.
+func crdKindOf(obj *unstructured.Unstructured) (gk schema.GroupKind, kind crdKind, ok bool) {
+	if obj.GroupVersionKind().GroupKind() != crdGroupKind {
+		return gk, kind, false
+	}
+
+	gk.Group, _, _ = unstructured.NestedString(obj.Object, "spec", "group")
+	gk.Kind, _, _ = unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	kind.resource, _, _ = unstructured.NestedString(obj.Object, "spec", "names", "plural")
+	scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+	kind.namespaced = scope != "Cluster"
+
+	kind.versions = map[string]bool{}
+	versions, _, _ := unstructured.NestedSlice(obj.Object, "spec", "versions")
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(version, "name")
+		served, _, _ := unstructured.NestedBool(version, "served")
+		kind.versions[name] = served
+	}
+	return gk, kind, true
+}
+
+// resolveNotInstalled fixes the guessed mapping of the info, whose kind is not
+// installed in the cluster, with the CustomResourceDefinition in the input.
+// It returns the mapping error if the input does not define the kind.
+func resolveNotInstalled(info *resource.Info, crds map[schema.GroupKind]crdKind, mappingErr error) error {
+	gvk := info.Mapping.GroupVersionKind
+	crd, ok := crds[gvk.GroupKind()]
+	if !ok || !crd.versions[gvk.Version] {
+		return fmt.Errorf("resource mapping not found for name: %q namespace: %q from %q: %w\nensure CRDs are installed first",
+			info.Name, info.Namespace, info.Source, mappingErr)
+	}
+
+	info.Mapping.Resource = gvk.GroupVersion().WithResource(crd.resource)
+	if !crd.namespaced {
+		info.Mapping.Scope = meta.RESTScopeRoot
+		info.Namespace = ""
+		info.Object.(*unstructured.Unstructured).SetNamespace("")
+	}
+	return nil
+}
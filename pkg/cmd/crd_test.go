@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/kubectl/pkg/cmd/diff"
+)
+
+// newCRD creates a CustomResourceDefinition object for the kind
+func newCRD(group, kind, plural, scope string, versions ...string) *unstructured.Unstructured {
+	var vs []interface{}
+	for _, v := range versions {
+		vs = append(vs, map[string]interface{}{"name": v, "served": true, "storage": true})
+	}
+
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"metadata": map[string]interface{}{
+				"name": plural + "." + group,
+			},
+			"spec": map[string]interface{}{
+				"group": group,
+				"names": map[string]interface{}{
+					"kind":   kind,
+					"plural": plural,
+				},
+				"scope":    scope,
+				"versions": vs,
+			},
+		},
+	}
+}
+
+// Test_pendingKindMapper_RESTMapping tests that kinds not installed in the cluster get a guessed mapping
+func Test_pendingKindMapper_RESTMapping(t *testing.T) {
+	installed := schema.GroupVersionKind{Group: "", Version: "v1", Kind: "ConfigMap"}
+	restMapper := meta.NewDefaultRESTMapper(nil)
+	restMapper.Add(installed, meta.RESTScopeNamespace)
+
+	mapper := &pendingKindMapper{RESTMapper: restMapper}
+
+	mapping, err := mapper.RESTMapping(installed.GroupKind(), installed.Version)
+	if err != nil {
+		t.Fatalf("RESTMapping() returned error for installed kind: %v", err)
+	}
+	if mapping.Resource.Resource != "configmaps" {
+		t.Errorf("expected resource %q, got %q", "configmaps", mapping.Resource.Resource)
+	}
+	if mapper.pendingErr(installed.GroupKind()) != nil {
+		t.Error("expected installed kind not to be pending")
+	}
+
+	notInstalled := schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+	mapping, err = mapper.RESTMapping(notInstalled.GroupKind(), notInstalled.Version)
+	if err != nil {
+		t.Fatalf("RESTMapping() returned error for not installed kind: %v", err)
+	}
+	if mapping.GroupVersionKind != notInstalled {
+		t.Errorf("expected guessed mapping for %v, got %v", notInstalled, mapping.GroupVersionKind)
+	}
+	if err := mapper.pendingErr(notInstalled.GroupKind()); !meta.IsNoMatchError(err) {
+		t.Errorf("expected the no match error to be recorded, got %v", err)
+	}
+}
+
+// Test_crdKindOf tests reading the kind defined by a CustomResourceDefinition
+func Test_crdKindOf(t *testing.T) {
+	gk, kind, ok := crdKindOf(newCRD("cert-manager.io", "ClusterIssuer", "clusterissuers", "Cluster", "v1"))
+	if !ok {
+		t.Fatal("expected a CustomResourceDefinition to be recognized")
+	}
+	if gk != (schema.GroupKind{Group: "cert-manager.io", Kind: "ClusterIssuer"}) {
+		t.Errorf("unexpected group kind: %v", gk)
+	}
+	if kind.resource != "clusterissuers" || kind.namespaced || !kind.versions["v1"] {
+		t.Errorf("unexpected kind: %+v", kind)
+	}
+
+	if _, _, ok := crdKindOf(newUnstructuredWithLabels(nil)); ok {
+		t.Error("expected a ConfigMap not to be recognized as a CustomResourceDefinition")
+	}
+}
+
+// Test_resolveNotInstalled tests resolving the mapping of objects whose kinds are not installed
+func Test_resolveNotInstalled(t *testing.T) {
+	crds := map[schema.GroupKind]crdKind{}
+	for _, crd := range []*unstructured.Unstructured{
+		newCRD("cert-manager.io", "Certificate", "certificates", "Namespaced", "v1"),
+		newCRD("cert-manager.io", "ClusterIssuer", "clusterissuers", "Cluster", "v1"),
+	} {
+		gk, kind, _ := crdKindOf(crd)
+		crds[gk] = kind
+	}
+	mappingErr := errors.New("no matches for kind")
+
+	tests := []struct {
+		name              string
+		gvk               schema.GroupVersionKind
+		expectError       bool
+		expectedResource  string
+		expectedNamespace string
+	}{
+		{
+			name:              "namespaced kind defined in the input",
+			gvk:               schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"},
+			expectedResource:  "certificates",
+			expectedNamespace: "default",
+		},
+		{
+			name:              "cluster-scoped kind defined in the input",
+			gvk:               schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "ClusterIssuer"},
+			expectedResource:  "clusterissuers",
+			expectedNamespace: "",
+		},
+		{
+			name:        "version not defined in the input",
+			gvk:         schema.GroupVersionKind{Group: "cert-manager.io", Version: "v2", Kind: "Certificate"},
+			expectError: true,
+		},
+		{
+			name:        "kind not defined in the input",
+			gvk:         schema.GroupVersionKind{Group: "external-secrets.io", Version: "v1", Kind: "ExternalSecret"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := newUnstructuredWithLabels(map[string]string{realNameLabel: "my-cert"})
+			obj.SetGroupVersionKind(tt.gvk)
+			info := &resource.Info{
+				Name:      obj.GetName(),
+				Namespace: obj.GetNamespace(),
+				Object:    obj,
+				Mapping: &meta.RESTMapping{
+					GroupVersionKind: tt.gvk,
+					Scope:            meta.RESTScopeNamespace,
+				},
+			}
+
+			err := resolveNotInstalled(info, crds, mappingErr)
+			if tt.expectError {
+				if !errors.Is(err, mappingErr) {
+					t.Errorf("expected the mapping error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveNotInstalled() returned error: %v", err)
+			}
+			if info.Mapping.Resource.Resource != tt.expectedResource {
+				t.Errorf("expected resource %q, got %q", tt.expectedResource, info.Mapping.Resource.Resource)
+			}
+			if info.Namespace != tt.expectedNamespace || obj.GetNamespace() != tt.expectedNamespace {
+				t.Errorf("expected namespace %q, got %q (object: %q)", tt.expectedNamespace, info.Namespace, obj.GetNamespace())
+			}
+		})
+	}
+}
+
+// Test_RealnameDiffInfoObject_notInstalled tests that objects of kinds not installed yet are diffed as new objects
+func Test_RealnameDiffInfoObject_notInstalled(t *testing.T) {
+	local := newUnstructuredWithLabels(map[string]string{realNameLabel: "my-cert"})
+	obj := RealnameDiffInfoObject{
+		infoObj: diff.InfoObject{
+			LocalObj: local,
+			Info:     &resource.Info{},
+		},
+		notInstalled: true,
+	}
+
+	if live := obj.Live(); live != nil {
+		t.Errorf("expected no live object, got %v", live)
+	}
+	merged, err := obj.Merged()
+	if err != nil {
+		t.Fatalf("Merged() returned error: %v", err)
+	}
+	if merged != local {
+		t.Errorf("expected the local object to be merged as is, got %v", merged)
+	}
+}
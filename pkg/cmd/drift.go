@@ -0,0 +1,439 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/cli-runtime/pkg/resource"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/utils/exec"
+	"sigs.k8s.io/structured-merge-diff/v6/fieldpath"
+)
+
+var (
+	driftLong = `Reports the live objects which differ from the input.
+
+For each object in the input, the live object is looked up by real name as in the
+diff, and the fields set in the input are compared with the live ones. The fields
+not set in the input, such as the defaults and the status, are ignored.
+
+The fields last updated by controllers are ignored too. Every field manager which
+updated the object is taken for a controller, except the ones for the edits by
+hand, whose names start with one of --edit-managers ("kubectl" by default), and
+"before-first-apply". Add the managers of the other tools used to edit objects by
+hand, such as "k9s", to report their edits as drift.
+
+Quantities are compared by their amounts, such as "1000m" and "1", and the
+stringData of Secrets is compared as data, since the server normalizes them. A live
+object with a different name from the local one is reported as not applied, since
+its content differs by the hash suffix.
+
+Exits with 1 if any object has drifted, is missing or is not applied.`
+
+	driftExample = `  # Report the objects changed in the cluster since the input was applied
+  kubectl realname-diff drift -k ./example`
+)
+
+// driftStatuses are the statuses of the objects reported by the drift command.
+const (
+	driftStatusInSync     = "in sync"
+	driftStatusDrifted    = "drifted"
+	driftStatusMissing    = "missing"
+	driftStatusNotApplied = "not applied"
+)
+
+func NewCmdDrift(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewDriftOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "drift -f FILENAME",
+		DisableFlagsInUseLine: true,
+		Short:                 "Report the live objects which differ from the input.",
+		Long:                  driftLong,
+		Example:               driftExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckDiffErr(options.Complete(factory))
+			cmdutil.CheckDiffErr(validateArgs(cmd, args))
+
+			if err := options.Run(); err != nil {
+				if exitErr := diffError(err); exitErr != nil {
+					os.Exit(exitErr.ExitStatus())
+				}
+				cmdutil.CheckDiffErr(err)
+			}
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&options.selector, "selector", "l", options.selector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.Flags().StringSliceVar(&options.matchLabels, "match-labels", options.matchLabels, "Label keys whose values must also match between the local and live objects when looking up by real name. (e.g. --match-labels app.kubernetes.io/instance)")
+	cmd.Flags().StringVar(&options.targetSelectionStrategy, "target-selection-strategy", targetSelectionStrategyError, "Specifies the behavior when multiple diff targets are found. The value must be either \"error\" or \"latest\". In \"latest\", the selection is based on \"metadata.creationTimestamp\"")
+	cmd.Flags().StringSliceVar(&options.editManagers, "edit-managers", options.editManagers, "Prefixes of the field managers which edit objects by hand. The fields updated by the other managers are taken for the ones managed by controllers, and ignored.")
+	cmdutil.AddFilenameOptionFlags(cmd, &options.filenameOptions, "Contains the configuration to detect drift against")
+
+	return cmd
+}
+
+type DriftOptions struct {
+	filenameOptions resource.FilenameOptions
+
+	selector                string
+	matchLabels             []string
+	targetSelectionStrategy string
+	editManagers            []string
+
+	cmdNamespace     string
+	enforceNamespace bool
+	builder          *resource.Builder
+	mapper           *pendingKindMapper
+
+	genericclioptions.IOStreams
+}
+
+func NewDriftOptions(streams genericclioptions.IOStreams) *DriftOptions {
+	return &DriftOptions{
+		editManagers: []string{"kubectl"},
+		IOStreams:    streams,
+	}
+}
+
+func (o *DriftOptions) Complete(factory cmdutil.Factory) error {
+	var err error
+
+	err = o.filenameOptions.RequireFilenameOrKustomize()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := targetSelectionStrategies[o.targetSelectionStrategy]; !ok {
+		return fmt.Errorf("--target-selection-strategy must be either \"error\" or \"latest\"")
+	}
+
+	o.cmdNamespace, o.enforceNamespace, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.builder, o.mapper, err = newPendingKindBuilder(factory)
+	return err
+}
+
+// driftResult is the result of the drift detection of a local object.
+type driftResult struct {
+	namespace string
+	kind      string
+	name      string
+	status    string
+
+	// details is the fields which have drifted, or the name of the live object which
+	// is not applied.
+	details string
+}
+
+// isEditManager returns whether the field manager edits objects by hand: its name
+// starts with one of the prefixes, or it is "before-first-apply", which holds the
+// fields set before the object was first applied.
+func isEditManager(manager string, editManagers []string) bool {
+	if manager == "before-first-apply" {
+		return true
+	}
+	for _, prefix := range editManagers {
+		if strings.HasPrefix(manager, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// controllerFields returns the fields of the live object managed by controllers:
+// the managers which updated the object other than the ones editing objects by hand.
+func controllerFields(live *unstructured.Unstructured, editManagers []string) (*fieldpath.Set, error) {
+	fields := &fieldpath.Set{}
+	for _, entry := range live.GetManagedFields() {
+		if entry.Operation != metav1.ManagedFieldsOperationUpdate || entry.FieldsV1 == nil {
+			continue
+		}
+		if isEditManager(entry.Manager, editManagers) {
+			continue
+		}
+
+		set := &fieldpath.Set{}
+		if err := set.FromJSON(bytes.NewReader(entry.FieldsV1.Raw)); err != nil {
+			return nil, fmt.Errorf("invalid managed fields of %s/%s by %s: %v", live.GetKind(), live.GetName(), entry.Manager, err)
+		}
+		fields = fields.Union(set)
+	}
+	return fields, nil
+}
+
+// removeField removes the field at the path from the value, and returns the value.
+func removeField(v interface{}, path fieldpath.Path) interface{} {
+	if len(path) == 0 {
+		return v
+	}
+
+	element := path[0]
+	if element.FieldName != nil {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		if len(path) == 1 {
+			delete(m, *element.FieldName)
+		} else if child, ok := m[*element.FieldName]; ok {
+			m[*element.FieldName] = removeField(child, path[1:])
+		}
+		return m
+	}
+
+	l, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	for i, item := range l {
+		if !matchesPathElement(item, i, element) {
+			continue
+		}
+		if len(path) == 1 {
+			return append(l[:i:i], l[i+1:]...)
+		}
+		l[i] = removeField(item, path[1:])
+		return l
+	}
+	return l
+}
+
+// matchesPathElement returns whether the i-th item of a list is the one the path
+// element points at.
+func matchesPathElement(item interface{}, i int, element fieldpath.PathElement) bool {
+	switch {
+	case element.Key != nil:
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for _, field := range *element.Key {
+			if !reflect.DeepEqual(m[field.Name], field.Value.Unstructured()) {
+				return false
+			}
+		}
+		return true
+	case element.Value != nil:
+		return reflect.DeepEqual(item, (*element.Value).Unstructured())
+	case element.Index != nil:
+		return *element.Index == i
+	}
+	return false
+}
+
+// driftedFields returns the paths of the fields whose live values differ from the
+// local ones. live is expected to be projected onto local.
+func driftedFields(local, live interface{}, prefix string) []string {
+	join := func(key string) string {
+		if len(prefix) == 0 {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	switch local := local.(type) {
+	case map[string]interface{}:
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			return []string{prefix}
+		}
+		keys := make([]string, 0, len(local))
+		for key := range local {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var fields []string
+		for _, key := range keys {
+			liveValue, ok := liveMap[key]
+			if !ok {
+				fields = append(fields, join(key))
+				continue
+			}
+			fields = append(fields, driftedFields(local[key], liveValue, join(key))...)
+		}
+		return fields
+
+	case []interface{}:
+		liveList, ok := live.([]interface{})
+		if !ok || len(liveList) != len(local) {
+			return []string{prefix}
+		}
+		var fields []string
+		for i := range local {
+			fields = append(fields, driftedFields(local[i], liveList[i], fmt.Sprintf("%s[%d]", prefix, i))...)
+		}
+		return fields
+	}
+
+	if !reflect.DeepEqual(local, live) && !equalQuantities(local, live) {
+		return []string{prefix}
+	}
+	return nil
+}
+
+// equalQuantities returns whether both values are quantities of the same amount,
+// such as "1000m" and "1", which the server may have normalized.
+func equalQuantities(local, live interface{}) bool {
+	parse := func(v interface{}) (apiresource.Quantity, bool) {
+		switch v := v.(type) {
+		case string:
+			q, err := apiresource.ParseQuantity(v)
+			return q, err == nil
+		case int64:
+			return *apiresource.NewQuantity(v, apiresource.DecimalSI), true
+		case float64:
+			q, err := apiresource.ParseQuantity(strconv.FormatFloat(v, 'f', -1, 64))
+			return q, err == nil
+		}
+		return apiresource.Quantity{}, false
+	}
+	localQuantity, ok := parse(local)
+	if !ok {
+		return false
+	}
+	liveQuantity, ok := parse(live)
+	return ok && localQuantity.Cmp(liveQuantity) == 0
+}
+
+// detectDrift compares the fields set in the local object with the live object,
+// ignoring the fields managed by controllers. The stringData of a local Secret is
+// compared as data, since the server stores it there.
+func detectDrift(local, live *unstructured.Unstructured, editManagers []string) ([]string, error) {
+	ignored, err := controllerFields(live, editManagers)
+	if err != nil {
+		return nil, err
+	}
+
+	local = local.DeepCopy()
+	if err := foldStringData(local); err != nil {
+		return nil, err
+	}
+	localObj := local.Object
+	liveObj := projectOnto(live.DeepCopy().Object, localObj)
+	ignored.Iterate(func(path fieldpath.Path) {
+		localObj = removeField(localObj, path).(map[string]interface{})
+		liveObj = removeField(liveObj, path)
+	})
+
+	return driftedFields(localObj, liveObj, ""), nil
+}
+
+func (o *DriftOptions) Run() error {
+	lookup := &realnameLookup{
+		strategy:    o.targetSelectionStrategy,
+		matchLabels: o.matchLabels,
+		selector:    o.selector,
+	}
+
+	r := o.builder.
+		Unstructured().
+		NamespaceParam(o.cmdNamespace).DefaultNamespace().
+		FilenameParam(o.enforceNamespace, &o.filenameOptions).
+		LabelSelectorParam(o.selector).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	var results []driftResult
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		local := info.Object.(*unstructured.Unstructured).DeepCopy()
+		result := driftResult{
+			namespace: info.Namespace,
+			kind:      info.Mapping.GroupVersionKind.Kind,
+			name:      info.Name,
+		}
+
+		if o.mapper.pendingErr(info.Mapping.GroupVersionKind.GroupKind()) != nil {
+			result.status = driftStatusMissing
+			results = append(results, result)
+			return nil
+		}
+
+		if on := realName(local); len(on) > 0 {
+			err = lookup.getWithRealName(info, local, on)
+		} else {
+			err = lookup.get(info, info.Name)
+		}
+		if isNotFound(err) {
+			result.status = driftStatusMissing
+			results = append(results, result)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		live := info.Object.(*unstructured.Unstructured)
+		if live.GetName() != local.GetName() {
+			result.status = driftStatusNotApplied
+			result.details = "live: " + live.GetName()
+			results = append(results, result)
+			return nil
+		}
+
+		fields, err := detectDrift(local, live, o.editManagers)
+		if err != nil {
+			return err
+		}
+		result.status = driftStatusInSync
+		if len(fields) > 0 {
+			result.status = driftStatusDrifted
+			result.details = strings.Join(fields, ", ")
+		}
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return printDriftResults(o.Out, results)
+}
+
+// printDriftResults prints the results, and returns an exit error with the status 1
+// if any object is not in sync.
+func printDriftResults(out io.Writer, results []driftResult) error {
+	w := printers.GetNewTabWriter(out)
+	fmt.Fprintln(w, "NAMESPACE\tKIND\tNAME\tSTATUS\tDETAILS")
+	var drifted int
+	for _, r := range results {
+		if r.status != driftStatusInSync {
+			drifted++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.namespace, r.kind, r.name, r.status, r.details)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if drifted > 0 {
+		return exec.CodeExitError{Err: fmt.Errorf("%d object(s) not in sync", drifted), Code: 1}
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/exec"
+	"sigs.k8s.io/structured-merge-diff/v6/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v6/value"
+)
+
+// newDeployment creates a Deployment with the replicas and the image of the container
+func newDeployment(replicas int64, image string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "nginx",
+			"namespace": "default",
+		},
+		"spec": map[string]interface{}{
+			"replicas": replicas,
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "nginx", "image": image},
+					},
+				},
+			},
+		},
+	}}
+}
+
+// Test_removeField tests removing fields pointed at by field paths from objects
+func Test_removeField(t *testing.T) {
+	obj := newDeployment(2, "nginx:1.1").Object
+
+	keyed := fieldpath.MakePathOrDie("spec", "template", "spec", "containers",
+		&value.FieldList{{Name: "name", Value: value.NewValueInterface("nginx")}}, "image")
+	obj = removeField(obj, keyed).(map[string]interface{})
+	containers, _, _ := unstructured.NestedSlice(obj, "spec", "template", "spec", "containers")
+	if !reflect.DeepEqual(containers, []interface{}{map[string]interface{}{"name": "nginx"}}) {
+		t.Errorf("expected the image to be removed, got %v", containers)
+	}
+
+	item := fieldpath.MakePathOrDie("spec", "template", "spec", "containers",
+		&value.FieldList{{Name: "name", Value: value.NewValueInterface("nginx")}})
+	obj = removeField(obj, item).(map[string]interface{})
+	containers, _, _ = unstructured.NestedSlice(obj, "spec", "template", "spec", "containers")
+	if len(containers) != 0 {
+		t.Errorf("expected the container to be removed, got %v", containers)
+	}
+
+	obj = removeField(obj, fieldpath.MakePathOrDie("spec", "missing", "field")).(map[string]interface{})
+	if replicas, _, _ := unstructured.NestedInt64(obj, "spec", "replicas"); replicas != 2 {
+		t.Errorf("expected the other fields to be kept, got %v", obj)
+	}
+}
+
+// Test_detectDrift tests detecting the fields changed in the cluster, ignoring the ones managed by controllers
+func Test_detectDrift(t *testing.T) {
+	managedBy := func(manager, fields string) metav1.ManagedFieldsEntry {
+		return metav1.ManagedFieldsEntry{
+			Manager:   manager,
+			Operation: metav1.ManagedFieldsOperationUpdate,
+			FieldsV1:  &metav1.FieldsV1{Raw: []byte(fields)},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		local        *unstructured.Unstructured
+		live         func() *unstructured.Unstructured
+		editManagers []string
+		expected     []string
+	}{
+		{
+			name:  "in sync with defaults and status",
+			local: newDeployment(2, "nginx:1.1"),
+			live: func() *unstructured.Unstructured {
+				live := newDeployment(2, "nginx:1.1")
+				_ = unstructured.SetNestedField(live.Object, int64(10), "spec", "revisionHistoryLimit")
+				_ = unstructured.SetNestedField(live.Object, int64(2), "status", "replicas")
+				live.SetResourceVersion("42")
+				return live
+			},
+		},
+		{
+			name:  "edited by hand",
+			local: newDeployment(2, "nginx:1.1"),
+			live: func() *unstructured.Unstructured {
+				live := newDeployment(2, "nginx:1.2")
+				live.SetManagedFields([]metav1.ManagedFieldsEntry{
+					managedBy("kubectl-edit", `{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"nginx\"}":{"f:image":{}}}}}}}`),
+				})
+				return live
+			},
+			expected: []string{"spec.template.spec.containers[0].image"},
+		},
+		{
+			name:  "scaled by a controller",
+			local: newDeployment(2, "nginx:1.1"),
+			live: func() *unstructured.Unstructured {
+				live := newDeployment(5, "nginx:1.1")
+				live.SetManagedFields([]metav1.ManagedFieldsEntry{
+					managedBy("kube-controller-manager", `{"f:spec":{"f:replicas":{}}}`),
+				})
+				return live
+			},
+		},
+		{
+			name:  "edited with another tool taken for a controller",
+			local: newDeployment(2, "nginx:1.1"),
+			live: func() *unstructured.Unstructured {
+				live := newDeployment(2, "nginx:1.2")
+				live.SetManagedFields([]metav1.ManagedFieldsEntry{
+					managedBy("k9s", `{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"nginx\"}":{"f:image":{}}}}}}}`),
+				})
+				return live
+			},
+		},
+		{
+			name:  "edited with another tool in the edit managers",
+			local: newDeployment(2, "nginx:1.1"),
+			live: func() *unstructured.Unstructured {
+				live := newDeployment(2, "nginx:1.2")
+				live.SetManagedFields([]metav1.ManagedFieldsEntry{
+					managedBy("k9s", `{"f:spec":{"f:template":{"f:spec":{"f:containers":{"k:{\"name\":\"nginx\"}":{"f:image":{}}}}}}}`),
+				})
+				return live
+			},
+			editManagers: []string{"kubectl", "k9s"},
+			expected:     []string{"spec.template.spec.containers[0].image"},
+		},
+		{
+			name: "data removed in the cluster",
+			local: func() *unstructured.Unstructured {
+				return newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", time.Time{})
+			}(),
+			live: func() *unstructured.Unstructured {
+				live := newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", time.Time{})
+				unstructured.RemoveNestedField(live.Object, "data", "test")
+				return live
+			},
+			expected: []string{"data.test"},
+		},
+		{
+			name: "quantities normalized by the server",
+			local: func() *unstructured.Unstructured {
+				local := newDeployment(2, "nginx:1.1")
+				_ = unstructured.SetNestedField(local.Object, []interface{}{
+					map[string]interface{}{"name": "nginx", "image": "nginx:1.1", "resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": "1000m", "memory": int64(1073741824)},
+					}},
+				}, "spec", "template", "spec", "containers")
+				return local
+			}(),
+			live: func() *unstructured.Unstructured {
+				live := newDeployment(2, "nginx:1.1")
+				_ = unstructured.SetNestedField(live.Object, []interface{}{
+					map[string]interface{}{"name": "nginx", "image": "nginx:1.1", "resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+					}},
+				}, "spec", "template", "spec", "containers")
+				return live
+			},
+		},
+		{
+			name: "float quantities normalized by the server",
+			local: func() *unstructured.Unstructured {
+				local := newDeployment(2, "nginx:1.1")
+				_ = unstructured.SetNestedField(local.Object, []interface{}{
+					map[string]interface{}{"name": "nginx", "image": "nginx:1.1", "resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": 0.5, "memory": 1.5},
+					}},
+				}, "spec", "template", "spec", "containers")
+				return local
+			}(),
+			live: func() *unstructured.Unstructured {
+				live := newDeployment(2, "nginx:1.1")
+				_ = unstructured.SetNestedField(live.Object, []interface{}{
+					map[string]interface{}{"name": "nginx", "image": "nginx:1.1", "resources": map[string]interface{}{
+						"requests": map[string]interface{}{"cpu": "500m", "memory": "1500m"},
+					}},
+				}, "spec", "template", "spec", "containers")
+				return live
+			},
+		},
+		{
+			name: "stringData stored as data",
+			local: func() *unstructured.Unstructured {
+				return &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Secret",
+					"metadata":   map[string]interface{}{"name": "basic-auth", "namespace": "default"},
+					"stringData": map[string]interface{}{"password": "secret"},
+				}}
+			}(),
+			live: func() *unstructured.Unstructured {
+				return &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Secret",
+					"metadata":   map[string]interface{}{"name": "basic-auth", "namespace": "default"},
+					"data":       map[string]interface{}{"password": "c2VjcmV0"},
+				}}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editManagers := tt.editManagers
+			if editManagers == nil {
+				editManagers = []string{"kubectl"}
+			}
+			fields, err := detectDrift(tt.local, tt.live(), editManagers)
+			if err != nil {
+				t.Fatalf("detectDrift() returned error: %v", err)
+			}
+			if !reflect.DeepEqual(fields, tt.expected) {
+				t.Errorf("detectDrift() = %v, want %v", fields, tt.expected)
+			}
+		})
+	}
+}
+
+// Test_printDriftResults tests exiting with 1 if any object is not in sync
+func Test_printDriftResults(t *testing.T) {
+	tests := []struct {
+		name           string
+		results        []driftResult
+		expectedStatus int
+	}{
+		{
+			name:    "in sync",
+			results: []driftResult{{namespace: "default", kind: "ConfigMap", name: "nginx-conf-abc", status: driftStatusInSync}},
+		},
+		{
+			name: "drifted",
+			results: []driftResult{
+				{namespace: "default", kind: "ConfigMap", name: "nginx-conf-abc", status: driftStatusInSync},
+				{namespace: "default", kind: "ConfigMap", name: "nginx-conf-def", status: driftStatusDrifted, details: "data.test"},
+			},
+			expectedStatus: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := printDriftResults(&out, tt.results)
+
+			status := 0
+			if exitErr, ok := err.(exec.ExitError); ok {
+				status = exitErr.ExitStatus()
+			} else if err != nil {
+				t.Fatalf("printDriftResults() returned error: %v", err)
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("exit status = %d, want %d", status, tt.expectedStatus)
+			}
+			for _, r := range tt.results {
+				if !strings.Contains(out.String(), r.name) {
+					t.Errorf("expected %s in the output, got:\n%s", r.name, out.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// checkDuplicateRealnames returns an error if objects of the same kind in a
+// namespace share a real name in the input, since they would be compared with the
+// same live object. With warnOnly, the duplicates are written to w instead.
+func checkDuplicateRealnames(infos []*resource.Info, warnOnly bool, w io.Writer) error {
+	objects := make([]*unstructured.Unstructured, 0, len(infos))
+	for _, info := range infos {
+		objects = append(objects, info.Object.(*unstructured.Unstructured))
+	}
+
+	duplicates := findDuplicateRealnames(objects)
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(duplicates))
+	for _, d := range duplicates {
+		messages = append(messages, fmt.Sprintf("multiple %s objects with realname=%s in namespace %q: %s",
+			d.key.groupKind, d.key.name, d.key.namespace, strings.Join(d.names, ", ")))
+	}
+	if !warnOnly {
+		return fmt.Errorf("the input has %s", strings.Join(messages, "; "))
+	}
+	for _, message := range messages {
+		fmt.Fprintf(w, "Warning: the input has %s, they are compared with the same live object\n", message)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// Test_checkDuplicateRealnames tests failing or warning if objects share a real name in the input
+func Test_checkDuplicateRealnames(t *testing.T) {
+	infos := []*resource.Info{
+		{Object: newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now())},
+		{Object: newConfigMapWithRealname("htpasswd-k7mbh9mm68", "htpasswd", time.Now())},
+	}
+
+	var out bytes.Buffer
+	if err := checkDuplicateRealnames(infos, false, &out); err != nil {
+		t.Errorf("expected no error without duplicates, got %v", err)
+	}
+
+	infos = append(infos, &resource.Info{Object: newConfigMapWithRealname("nginx-conf-bct5bfcfmg", "nginx-conf", time.Now())})
+	err := checkDuplicateRealnames(infos, false, &out)
+	expected := `multiple ConfigMap objects with realname=nginx-conf in namespace "default": nginx-conf-bc58dhk76g, nginx-conf-bct5bfcfmg`
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error containing %q, got %v", expected, err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no warning, got %q", out.String())
+	}
+
+	if err := checkDuplicateRealnames(infos, true, &out); err != nil {
+		t.Errorf("expected no error with warnOnly, got %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Warning: the input has "+expected) {
+		t.Errorf("expected a warning, got %q", out.String())
+	}
+}
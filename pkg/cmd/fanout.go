@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/kubectl/pkg/cmd/diff"
+	"k8s.io/utils/exec"
+)
+
+// contextDiff is the diff against the cluster of a context with --contexts.
+type contextDiff struct {
+	context string
+	options *RealnameDiffOptions
+
+	captured capturedDiff
+	errOut   lockedBuffer
+	err      error
+}
+
+// lockedBuffer is a bytes.Buffer which can be written concurrently, since the
+// objects of a context are diffed in parallel with --concurrency.
+type lockedBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+// exitStatus returns the exit status of the diff as if it were run alone.
+func (c *contextDiff) exitStatus() int {
+	switch {
+	case c.err != nil:
+		return 2
+	case len(c.captured.text) > 0:
+		return 1
+	}
+	return 0
+}
+
+// capturedDiff holds the diff in the unified format instead of running the diff
+// program, so that the diffs against different clusters can be compared.
+type capturedDiff struct {
+	text string
+}
+
+func (c *capturedDiff) run(differ *diff.Differ) error {
+	from, to := differ.From.Dir.Name, differ.To.Dir.Name
+
+	var out bytes.Buffer
+	cmd := exec.New().Command("diff", "-u", "-N", from, to)
+	cmd.SetStdout(&out)
+	cmd.SetStderr(&out)
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(exec.ExitError); !ok || exitErr.ExitStatus() != 1 {
+			return fmt.Errorf("diff: %v: %s", err, strings.TrimSpace(out.String()))
+		}
+	}
+
+	c.text = normalizeDiff(out.String(), from, to)
+	return nil
+}
+
+// normalizeDiff replaces the temporary directories in the diff with the names of the
+// versions, and removes the timestamps of the files.
+func normalizeDiff(text, from, to string) string {
+	var b strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") {
+			line, _, _ = strings.Cut(line, "\t")
+		}
+		if strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") {
+			line = strings.ReplaceAll(line, from, "LIVE")
+			line = strings.ReplaceAll(line, to, "MERGED")
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// matchContexts returns the names of the contexts in the kubeconfig matching any of
+// the patterns, sorted by name. Each pattern must match at least one context.
+func matchContexts(patterns []string, contexts map[string]*clientcmdapi.Context) ([]string, error) {
+	matched := map[string]bool{}
+	for _, pattern := range patterns {
+		found := false
+		for name := range contexts {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid context pattern %q: %v", pattern, err)
+			}
+			if ok {
+				matched[name] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no context matches %q", pattern)
+		}
+	}
+
+	var names []string
+	for name := range matched {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// completeContexts completes the options of the diff against each context of
+// --contexts. The errors of the contexts are reported with their results instead of
+// failing the others.
+func (o *RealnameDiffOptions) completeContexts(contexts map[string]*clientcmdapi.Context, cmd *cobra.Command) error {
+	if cmd.Flags().Changed("context") {
+		return fmt.Errorf("--context cannot be used with --contexts")
+	}
+	if len(o.liveFrom) > 0 || len(o.compareContext) > 0 || len(o.savePlan) > 0 || o.threeWay {
+		return fmt.Errorf("--live-from, --compare-context, --save-plan and --three-way cannot be used with --contexts")
+	}
+
+	names, err := matchContexts(o.contexts, contexts)
+	if err != nil {
+		return err
+	}
+
+	// The standard input is read only once, and given to each diff as a file.
+	for i, filename := range o.filenameOptions.Filenames {
+		if filename != "-" {
+			continue
+		}
+		f, err := os.CreateTemp("", "realname-diff-stdin-*.yaml")
+		if err != nil {
+			return err
+		}
+		o.stdinFile = f.Name()
+		_, err = io.Copy(f, o.diffProgram.In)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+		o.filenameOptions.Filenames[i] = o.stdinFile
+	}
+
+	for _, name := range names {
+		c := &contextDiff{context: name}
+
+		options := *o
+		options.contexts = nil
+		options.diffProgram = &diff.DiffProgram{
+			Exec:      exec.New(),
+			IOStreams: genericclioptions.IOStreams{Out: io.Discard, ErrOut: &c.errOut},
+		}
+		options.capture = &c.captured
+		c.options = &options
+		c.err = options.Complete(newContextFactory(cmd, name), cmd)
+
+		o.fanout = append(o.fanout, c)
+	}
+	return nil
+}
+
+// runContexts runs the diff against each context concurrently, and reports the
+// results with the identical diffs grouped.
+func (o *RealnameDiffOptions) runContexts() error {
+	if len(o.stdinFile) > 0 {
+		defer os.Remove(o.stdinFile)
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range o.fanout {
+		if c.err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(c *contextDiff) {
+			defer wg.Done()
+			c.err = c.options.Run()
+		}(c)
+	}
+	wg.Wait()
+
+	return reportContexts(o.fanout, o.diffProgram.Out, o.diffProgram.ErrOut)
+}
+
+// reportContexts prints the diffs of the contexts, grouping the identical ones, and
+// the exit status of each context. The output to the standard error of each context
+// is prefixed with its name.
+func reportContexts(fanout []*contextDiff, out, errOut io.Writer) error {
+	for _, c := range fanout {
+		scanner := bufio.NewScanner(&c.errOut)
+		for scanner.Scan() {
+			fmt.Fprintf(errOut, "[%s] %s\n", c.context, scanner.Text())
+		}
+	}
+
+	var diffs []string
+	groups := map[string][]string{}
+	for _, c := range fanout {
+		if c.exitStatus() != 1 {
+			continue
+		}
+		if _, ok := groups[c.captured.text]; !ok {
+			diffs = append(diffs, c.captured.text)
+		}
+		groups[c.captured.text] = append(groups[c.captured.text], c.context)
+	}
+	for _, text := range diffs {
+		contexts := groups[text]
+		fmt.Fprintf(out, "=== Differences in %d context(s): %s ===\n", len(contexts), strings.Join(contexts, ", "))
+		fmt.Fprint(out, text)
+	}
+
+	var failed, differed int
+	w := printers.GetNewTabWriter(out)
+	fmt.Fprintln(w, "CONTEXT\tEXIT STATUS\tRESULT")
+	for _, c := range fanout {
+		result := "no differences"
+		switch c.exitStatus() {
+		case 1:
+			result = "differences"
+			differed++
+		case 2:
+			result = "error: " + c.err.Error()
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", c.context, c.exitStatus(), result)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("the diff failed in %d of %d context(s)", failed, len(fanout))
+	}
+	if differed > 0 {
+		return exec.CodeExitError{Err: fmt.Errorf("differences found in %d of %d context(s)", differed, len(fanout)), Code: 1}
+	}
+	return nil
+}
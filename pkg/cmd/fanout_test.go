@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/utils/exec"
+)
+
+// Test_normalizeDiff tests removing the temporary directories and the timestamps from the diff
+func Test_normalizeDiff(t *testing.T) {
+	text := `diff -u -N /tmp/LIVE-123/v1.ConfigMap.default.nginx-conf /tmp/MERGED-456/v1.ConfigMap.default.nginx-conf
+--- /tmp/LIVE-123/v1.ConfigMap.default.nginx-conf	2021-12-24 00:04:23.000000000 +0900
++++ /tmp/MERGED-456/v1.ConfigMap.default.nginx-conf	2021-12-24 00:04:24.000000000 +0900
+@@ -1,1 +1,1 @@
+-  test: /tmp/LIVE-123
++  test: data
+`
+	expected := `diff -u -N LIVE/v1.ConfigMap.default.nginx-conf MERGED/v1.ConfigMap.default.nginx-conf
+--- LIVE/v1.ConfigMap.default.nginx-conf
++++ MERGED/v1.ConfigMap.default.nginx-conf
+@@ -1,1 +1,1 @@
+-  test: /tmp/LIVE-123
++  test: data
+`
+
+	if result := normalizeDiff(text, "/tmp/LIVE-123", "/tmp/MERGED-456"); result != expected {
+		t.Errorf("normalizeDiff() = %q, want %q", result, expected)
+	}
+}
+
+// Test_matchContexts tests selecting the contexts by names and patterns
+func Test_matchContexts(t *testing.T) {
+	contexts := map[string]*clientcmdapi.Context{
+		"prod-east": {},
+		"prod-west": {},
+		"staging":   {},
+	}
+
+	tests := []struct {
+		name        string
+		patterns    []string
+		expected    []string
+		expectError bool
+	}{
+		{
+			name:     "names and patterns",
+			patterns: []string{"staging", "prod-*"},
+			expected: []string{"prod-east", "prod-west", "staging"},
+		},
+		{
+			name:     "overlapping patterns",
+			patterns: []string{"prod-*", "*-east"},
+			expected: []string{"prod-east", "prod-west"},
+		},
+		{
+			name:        "no match",
+			patterns:    []string{"dev"},
+			expectError: true,
+		},
+		{
+			name:        "invalid pattern",
+			patterns:    []string{"prod-["},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := matchContexts(tt.patterns, contexts)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("matchContexts() returned error: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("matchContexts() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+// Test_reportContexts tests grouping the identical diffs and reporting the exit status of each context
+func Test_reportContexts(t *testing.T) {
+	newContextDiff := func(context, text, stderr string, err error) *contextDiff {
+		c := &contextDiff{context: context, captured: capturedDiff{text: text}, err: err}
+		c.errOut.WriteString(stderr)
+		return c
+	}
+
+	tests := []struct {
+		name           string
+		fanout         []*contextDiff
+		expectedOut    []string
+		expectedErrOut string
+		expectedStatus int
+	}{
+		{
+			name: "identical diffs",
+			fanout: []*contextDiff{
+				newContextDiff("prod-east", "-a\n+b\n", "", nil),
+				newContextDiff("prod-west", "-a\n+b\n", "warning\n", nil),
+				newContextDiff("staging", "", "", nil),
+			},
+			expectedOut: []string{
+				"=== Differences in 2 context(s): prod-east, prod-west ===\n-a\n+b\n",
+				"prod-east   1             differences\n",
+				"staging     0             no differences\n",
+			},
+			expectedErrOut: "[prod-west] warning\n",
+			expectedStatus: 1,
+		},
+		{
+			name: "different diffs and an error",
+			fanout: []*contextDiff{
+				newContextDiff("prod-east", "-a\n+b\n", "", nil),
+				newContextDiff("prod-west", "-a\n+c\n", "", nil),
+				newContextDiff("staging", "", "", fmt.Errorf("unreachable")),
+			},
+			expectedOut: []string{
+				"=== Differences in 1 context(s): prod-east ===\n-a\n+b\n",
+				"=== Differences in 1 context(s): prod-west ===\n-a\n+c\n",
+				"staging     2             error: unreachable\n",
+			},
+			expectedStatus: 2,
+		},
+		{
+			name: "no differences",
+			fanout: []*contextDiff{
+				newContextDiff("staging", "", "", nil),
+			},
+			expectedOut:    []string{"staging   0             no differences\n"},
+			expectedStatus: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			err := reportContexts(tt.fanout, &out, &errOut)
+
+			for _, expected := range tt.expectedOut {
+				if !strings.Contains(out.String(), expected) {
+					t.Errorf("expected the output to contain %q, got:\n%s", expected, out.String())
+				}
+			}
+			if errOut.String() != tt.expectedErrOut {
+				t.Errorf("stderr = %q, want %q", errOut.String(), tt.expectedErrOut)
+			}
+
+			status := 0
+			if exitErr, ok := err.(exec.ExitError); ok {
+				status = exitErr.ExitStatus()
+			} else if err != nil {
+				status = 2
+			}
+			if status != tt.expectedStatus {
+				t.Errorf("exit status = %d (%v), want %d", status, err, tt.expectedStatus)
+			}
+		})
+	}
+}
+
+// Test_lockedBuffer tests that the lines written concurrently are not interleaved
+func Test_lockedBuffer(t *testing.T) {
+	var b lockedBuffer
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fmt.Fprintf(&b, "Warning: line %d of writer %d\n", j, i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 1000 {
+		t.Fatalf("expected 1000 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "Warning: line ") {
+			t.Errorf("unexpected line: %q", line)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+var (
+	gcLong = `Deletes old live generations of the real names in the input.
+
+For each real name in the input, the live objects having it are deleted unless
+they have the same name as the local object or are referenced by a live workload.
+The newest generations can be kept with --keep.
+
+By default, only the plan is printed. Pass --confirm to delete the objects.`
+
+	gcExample = `  # Print the generations which would be deleted
+  kubectl realname-diff gc -k ./example
+
+  # Delete them, keeping the newest one for rollbacks
+  kubectl realname-diff gc -k ./example --keep 1 --confirm`
+)
+
+func NewCmdGC(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewGCOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "gc -f FILENAME",
+		DisableFlagsInUseLine: true,
+		Short:                 "Delete old live generations of the real names in the input.",
+		Long:                  gcLong,
+		Example:               gcExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(options.Complete(factory))
+			cmdutil.CheckErr(validateArgs(cmd, args))
+			cmdutil.CheckErr(options.Run())
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&options.selector, "selector", "l", options.selector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.Flags().StringSliceVar(&options.matchLabels, "match-labels", options.matchLabels, "Label keys whose values must also match between the local and live objects when looking up by real name. (e.g. --match-labels app.kubernetes.io/instance)")
+	cmd.Flags().IntVar(&options.keep, "keep", options.keep, "Number of the newest unused generations to keep for each real name.")
+	cmd.Flags().BoolVar(&options.confirm, "confirm", options.confirm, "If true, delete the objects. Otherwise, only the plan is printed.")
+	cmdutil.AddFilenameOptionFlags(cmd, &options.filenameOptions, "Contains the configuration to collect garbage for")
+
+	return cmd
+}
+
+type GCOptions struct {
+	filenameOptions resource.FilenameOptions
+
+	selector    string
+	matchLabels []string
+	keep        int
+	confirm     bool
+
+	dynamicClient    dynamic.Interface
+	cmdNamespace     string
+	enforceNamespace bool
+	builder          *resource.Builder
+	mapper           *pendingKindMapper
+
+	genericclioptions.IOStreams
+}
+
+func NewGCOptions(streams genericclioptions.IOStreams) *GCOptions {
+	return &GCOptions{
+		IOStreams: streams,
+	}
+}
+
+func (o *GCOptions) Complete(factory cmdutil.Factory) error {
+	var err error
+
+	err = o.filenameOptions.RequireFilenameOrKustomize()
+	if err != nil {
+		return err
+	}
+
+	if o.keep < 0 {
+		return fmt.Errorf("--keep must not be negative")
+	}
+
+	o.dynamicClient, err = factory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	o.cmdNamespace, o.enforceNamespace, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.builder, o.mapper, err = newPendingKindBuilder(factory)
+	return err
+}
+
+// gcPlanEntry is an unused live generation and whether it is deleted.
+type gcPlanEntry struct {
+	orphan
+	delete bool
+}
+
+// planGC decides which of the unused generations are deleted, keeping the newest
+// keep generations of each real name.
+func planGC(orphans []orphan, keep int) []gcPlanEntry {
+	type group struct {
+		scope    indexKey
+		realname string
+	}
+	groups := map[group][]int{}
+	for i, o := range orphans {
+		g := group{scope: scopeOf(o.info), realname: o.realname}
+		groups[g] = append(groups[g], i)
+	}
+
+	plan := make([]gcPlanEntry, len(orphans))
+	for i, o := range orphans {
+		plan[i] = gcPlanEntry{orphan: o, delete: true}
+	}
+	for _, indexes := range groups {
+		sort.SliceStable(indexes, func(i, j int) bool {
+			return orphans[indexes[j]].creationTimestamp.Before(&orphans[indexes[i]].creationTimestamp)
+		})
+		for i := 0; i < keep && i < len(indexes); i++ {
+			plan[indexes[i]].delete = false
+		}
+	}
+	return plan
+}
+
+// printGCPlan prints the plan as a table.
+func printGCPlan(out io.Writer, plan []gcPlanEntry) error {
+	w := printers.GetNewTabWriter(out)
+	fmt.Fprintln(w, "NAMESPACE\tKIND\tNAME\tREALNAME\tCREATED\tACTION")
+	for _, e := range plan {
+		action := "keep"
+		if e.delete {
+			action = "delete"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.info.Namespace,
+			e.info.Mapping.GroupVersionKind.Kind,
+			e.info.Name,
+			e.realname,
+			e.creationTimestamp.UTC().Format(time.RFC3339),
+			action,
+		)
+	}
+	return w.Flush()
+}
+
+func (o *GCOptions) Run() error {
+	lookup := &realnameLookup{
+		matchLabels: o.matchLabels,
+		selector:    o.selector,
+	}
+	tracker := newOrphanTracker(false)
+
+	r := o.builder.
+		Unstructured().
+		NamespaceParam(o.cmdNamespace).DefaultNamespace().
+		FilenameParam(o.enforceNamespace, &o.filenameOptions).
+		LabelSelectorParam(o.selector).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		// Kinds not installed yet have no live generations.
+		if o.mapper.pendingErr(info.Mapping.GroupVersionKind.GroupKind()) != nil {
+			return nil
+		}
+		return tracker.add(info, info.Object.(*unstructured.Unstructured))
+	})
+	if err != nil {
+		return err
+	}
+
+	orphans, err := tracker.find(lookup, o.dynamicClient)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		fmt.Fprintln(o.ErrOut, "No unused generations found.")
+		return nil
+	}
+
+	plan := planGC(orphans, o.keep)
+	if err := printGCPlan(o.Out, plan); err != nil {
+		return err
+	}
+
+	var deletions int
+	for _, e := range plan {
+		if e.delete {
+			deletions++
+		}
+	}
+	if !o.confirm {
+		fmt.Fprintf(o.ErrOut, "Dry run: %d object(s) would be deleted. Pass --confirm to delete them.\n", deletions)
+		return nil
+	}
+
+	for _, e := range plan {
+		if !e.delete {
+			continue
+		}
+		if err := deleteGeneration(e.orphan); err != nil {
+			return err
+		}
+		fmt.Fprintf(o.Out, "%s/%s deleted\n", strings.ToLower(e.info.Mapping.GroupVersionKind.Kind), e.info.Name)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// newOrphan creates an unused generation of the real name created at the time
+func newOrphan(name, realname string, created time.Time) orphan {
+	return orphan{
+		info: &resource.Info{
+			Mapping:   configMapMapping,
+			Namespace: "default",
+			Name:      name,
+		},
+		realname:          realname,
+		creationTimestamp: metav1.NewTime(created),
+	}
+}
+
+// Test_planGC tests keeping the newest unused generations of each real name
+func Test_planGC(t *testing.T) {
+	base := time.Date(2021, 12, 23, 15, 0, 0, 0, time.UTC)
+	orphans := []orphan{
+		newOrphan("nginx-conf-1", "nginx-conf", base),
+		newOrphan("nginx-conf-3", "nginx-conf", base.Add(2*time.Hour)),
+		newOrphan("nginx-conf-2", "nginx-conf", base.Add(time.Hour)),
+		newOrphan("htpasswd-1", "htpasswd", base),
+	}
+
+	tests := []struct {
+		name     string
+		keep     int
+		expected map[string]bool
+	}{
+		{
+			name: "keep none",
+			keep: 0,
+			expected: map[string]bool{
+				"nginx-conf-1": true,
+				"nginx-conf-2": true,
+				"nginx-conf-3": true,
+				"htpasswd-1":   true,
+			},
+		},
+		{
+			name: "keep the newest one of each real name",
+			keep: 1,
+			expected: map[string]bool{
+				"nginx-conf-1": true,
+				"nginx-conf-2": true,
+				"nginx-conf-3": false,
+				"htpasswd-1":   false,
+			},
+		},
+		{
+			name: "keep more than existing",
+			keep: 5,
+			expected: map[string]bool{
+				"nginx-conf-1": false,
+				"nginx-conf-2": false,
+				"nginx-conf-3": false,
+				"htpasswd-1":   false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := planGC(orphans, tt.keep)
+			if len(plan) != len(orphans) {
+				t.Fatalf("expected %d entries, got %d", len(orphans), len(plan))
+			}
+			for _, e := range plan {
+				if e.delete != tt.expected[e.info.Name] {
+					t.Errorf("%s: delete = %v, want %v", e.info.Name, e.delete, tt.expected[e.info.Name])
+				}
+			}
+		})
+	}
+}
+
+// Test_printGCPlan tests printing the plan as a table
+func Test_printGCPlan(t *testing.T) {
+	created := time.Date(2021, 12, 23, 15, 0, 12, 0, time.UTC)
+	plan := []gcPlanEntry{
+		{orphan: newOrphan("nginx-conf-m5d2cggb7k", "nginx-conf", created), delete: true},
+	}
+
+	var out bytes.Buffer
+	if err := printGCPlan(&out, plan); err != nil {
+		t.Fatalf("printGCPlan() returned error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a header and a row, got %q", out.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "default ConfigMap nginx-conf-m5d2cggb7k nginx-conf 2021-12-23T15:00:12Z delete" {
+		t.Errorf("unexpected row: %q", lines[1])
+	}
+}
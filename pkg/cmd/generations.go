@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/kubectl/pkg/cmd/diff"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/utils/exec"
+)
+
+var (
+	generationsLong = `Diffs two live generations of a real name.
+
+By default, the newest generation is compared with the one before it. --to selects
+the newer side by name. --from selects the older side by name, or by -N to take the
+Nth generation before the --to one.`
+
+	generationsExample = `  # Diff the previous and the current generations of the ConfigMap "nginx-conf"
+  kubectl realname-diff generations configmap nginx-conf
+
+  # Diff the generation two before the current one with the current one
+  kubectl realname-diff generations configmap nginx-conf --from -2
+
+  # Diff two generations by name
+  kubectl realname-diff generations configmap nginx-conf --from nginx-conf-9h7k2m5t6f --to nginx-conf-m5d2cggb7k`
+)
+
+func NewCmdGenerations(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewGenerationsOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "generations KIND REALNAME [--from NAME|-N] [--to NAME]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Diff two live generations of a real name.",
+		Long:                  generationsLong,
+		Example:               generationsExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckDiffErr(options.Complete(factory, cmd, args))
+
+			if err := options.Run(); err != nil {
+				if exitErr := diffError(err); exitErr != nil {
+					os.Exit(exitErr.ExitStatus())
+				}
+				cmdutil.CheckDiffErr(err)
+			}
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&options.from, "from", options.from, "Name of the older generation, or -N for the Nth generation before the newer one.")
+	cmd.Flags().StringVar(&options.to, "to", options.to, "Name of the newer generation. Defaults to the newest one.")
+	cmd.Flags().BoolVar(&options.showManagedFields, "show-managed-fields", options.showManagedFields, "If true, include managed fields in the diff.")
+
+	return cmd
+}
+
+type GenerationsOptions struct {
+	kind     string
+	realname string
+	from     string
+	to       string
+
+	showManagedFields bool
+
+	cmdNamespace string
+	builder      *resource.Builder
+	diffProgram  *diff.DiffProgram
+}
+
+func NewGenerationsOptions(streams genericclioptions.IOStreams) *GenerationsOptions {
+	return &GenerationsOptions{
+		from: "-1",
+		diffProgram: &diff.DiffProgram{
+			Exec:      exec.New(),
+			IOStreams: streams,
+		},
+	}
+}
+
+func (o *GenerationsOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+
+	if len(args) != 2 {
+		return cmdutil.UsageErrorf(cmd, "KIND and REALNAME are required")
+	}
+	o.kind, o.realname = args[0], args[1]
+
+	o.cmdNamespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.builder = factory.NewBuilder()
+
+	return nil
+}
+
+// pairObject is an implementation of the diff.Object interface which compares two
+// objects given as they are, such as two live generations of a real name or the
+// objects of two local builds.
+type pairObject struct {
+	from *unstructured.Unstructured
+	to   *unstructured.Unstructured
+	name string
+}
+
+var _ diff.Object = &pairObject{}
+
+// Live returns the older object, or nil if there is none. The
+// 'last-applied-configuration' annotation is deleted as in the diff of renamed
+// objects.
+func (obj pairObject) Live() runtime.Object {
+	if obj.from == nil {
+		return nil
+	}
+	from := obj.from.DeepCopy()
+	deleteLastApplied(from)
+	return from
+}
+
+// Merged returns the newer object. The 'last-applied-configuration' annotation is
+// deleted as in the diff of renamed objects.
+func (obj pairObject) Merged() (runtime.Object, error) {
+	to := obj.to.DeepCopy()
+	deleteLastApplied(to)
+	return to, nil
+}
+
+func (obj pairObject) Name() string {
+	return obj.name
+}
+
+// selectGenerations selects the older and the newer generations to compare from the
+// generations sorted newest first.
+func selectGenerations(generations []*resource.Info, from, to string) (*resource.Info, *resource.Info, error) {
+	indexOf := func(name string) (int, error) {
+		for i, g := range generations {
+			if g.Name == name {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("no generation named %q found", name)
+	}
+
+	var toIndex int
+	if len(to) > 0 {
+		i, err := indexOf(to)
+		if err != nil {
+			return nil, nil, err
+		}
+		toIndex = i
+	}
+
+	var fromIndex int
+	if strings.HasPrefix(from, "-") {
+		n, err := strconv.Atoi(from[1:])
+		if err != nil || n <= 0 {
+			return nil, nil, fmt.Errorf("--from must be either a name or -N with a positive N, got %q", from)
+		}
+		fromIndex = toIndex + n
+		if fromIndex >= len(generations) {
+			return nil, nil, fmt.Errorf("no generation found %d before %q, only %d generation(s) exist",
+				n, generations[toIndex].Name, len(generations))
+		}
+	} else {
+		i, err := indexOf(from)
+		if err != nil {
+			return nil, nil, err
+		}
+		fromIndex = i
+	}
+
+	return generations[fromIndex], generations[toIndex], nil
+}
+
+func (o *GenerationsOptions) Run() error {
+	var generations []*resource.Info
+	err := visitGenerations(o.builder, o.cmdNamespace, o.kind, o.realname, func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		generations = append(generations, info)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(generations) == 0 {
+		return fmt.Errorf("no generations found for realname=%s", o.realname)
+	}
+	sort.SliceStable(generations, func(i, j int) bool {
+		ti := generations[i].Object.(*unstructured.Unstructured).GetCreationTimestamp()
+		tj := generations[j].Object.(*unstructured.Unstructured).GetCreationTimestamp()
+		return tj.Before(&ti)
+	})
+
+	from, to, err := selectGenerations(generations, o.from, o.to)
+	if err != nil {
+		return err
+	}
+
+	return diffGenerations(from, to, o.realname, o.showManagedFields, o.diffProgram)
+}
+
+// diffGenerations runs the diff program on the two live generations of the real name.
+func diffGenerations(from, to *resource.Info, realname string, showManagedFields bool, diffProgram *diff.DiffProgram) error {
+	// The differ only knows these versions, which are the older and the newer
+	// sides of pairObject.
+	differ, err := diff.NewDiffer("LIVE", "MERGED")
+	if err != nil {
+		return err
+	}
+	defer differ.TearDown()
+
+	obj := pairObject{
+		from: from.Object.(*unstructured.Unstructured),
+		to:   to.Object.(*unstructured.Unstructured),
+		// Both sides are named after the real name so that they are paired.
+		name: diff.InfoObject{Info: &resource.Info{Mapping: to.Mapping, Namespace: to.Namespace, Name: realname}}.Name(),
+	}
+	if err := differ.Diff(obj, diff.Printer{}, showManagedFields); err != nil {
+		return err
+	}
+
+	return differ.Run(diffProgram)
+}
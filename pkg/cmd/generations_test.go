@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/kubectl/pkg/cmd/diff"
+	"k8s.io/utils/exec"
+)
+
+// Test_selectGenerations tests selecting the generations to compare by name or by offset
+func Test_selectGenerations(t *testing.T) {
+	generations := []*resource.Info{
+		{Name: "nginx-conf-3"},
+		{Name: "nginx-conf-2"},
+		{Name: "nginx-conf-1"},
+	}
+
+	tests := []struct {
+		name         string
+		from         string
+		to           string
+		expectedFrom string
+		expectedTo   string
+		expectError  bool
+	}{
+		{
+			name:         "previous generation by default",
+			from:         "-1",
+			expectedFrom: "nginx-conf-2",
+			expectedTo:   "nginx-conf-3",
+		},
+		{
+			name:         "offset from the newest",
+			from:         "-2",
+			expectedFrom: "nginx-conf-1",
+			expectedTo:   "nginx-conf-3",
+		},
+		{
+			name:         "offset from --to",
+			from:         "-1",
+			to:           "nginx-conf-2",
+			expectedFrom: "nginx-conf-1",
+			expectedTo:   "nginx-conf-2",
+		},
+		{
+			name:         "by name",
+			from:         "nginx-conf-1",
+			to:           "nginx-conf-2",
+			expectedFrom: "nginx-conf-1",
+			expectedTo:   "nginx-conf-2",
+		},
+		{
+			name:        "offset beyond the oldest",
+			from:        "-3",
+			expectError: true,
+		},
+		{
+			name:        "invalid offset",
+			from:        "-0",
+			expectError: true,
+		},
+		{
+			name:        "unknown name",
+			from:        "nginx-conf-0",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := selectGenerations(generations, tt.from, tt.to)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectGenerations() returned error: %v", err)
+			}
+			if from.Name != tt.expectedFrom || to.Name != tt.expectedTo {
+				t.Errorf("selectGenerations() = (%s, %s), want (%s, %s)", from.Name, to.Name, tt.expectedFrom, tt.expectedTo)
+			}
+		})
+	}
+}
+
+// Test_pairObject tests that the 'last-applied-configuration' annotation is removed from both sides
+func Test_pairObject(t *testing.T) {
+	base := time.Date(2021, 12, 23, 15, 0, 0, 0, time.UTC)
+	from := newConfigMapWithRealname("nginx-conf-1", "nginx-conf", base)
+	to := newConfigMapWithRealname("nginx-conf-2", "nginx-conf", base.Add(time.Hour))
+	for _, obj := range []*unstructured.Unstructured{from, to} {
+		obj.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"})
+	}
+
+	obj := pairObject{from: from, to: to, name: "v1.ConfigMap.default.nginx-conf"}
+	merged, err := obj.Merged()
+	if err != nil {
+		t.Fatalf("Merged() returned error: %v", err)
+	}
+
+	for side, o := range map[string]*unstructured.Unstructured{
+		"live":   obj.Live().(*unstructured.Unstructured),
+		"merged": merged.(*unstructured.Unstructured),
+	} {
+		if _, ok := o.GetAnnotations()["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+			t.Errorf("%s: expected the 'last-applied-configuration' annotation to be removed", side)
+		}
+	}
+	if _, ok := from.GetAnnotations()["kubectl.kubernetes.io/last-applied-configuration"]; !ok {
+		t.Errorf("expected the original object not to be modified")
+	}
+}
+
+// Test_diffGenerations tests running the diff program on the two generations named after the real name
+func Test_diffGenerations(t *testing.T) {
+	executor := exec.New()
+	if _, err := executor.LookPath("diff"); err != nil {
+		t.Skip("diff is not installed")
+	}
+	t.Setenv("KUBECTL_EXTERNAL_DIFF", "")
+
+	base := time.Date(2021, 12, 23, 15, 0, 0, 0, time.UTC)
+	mapping := &meta.RESTMapping{
+		Resource:         corev1.SchemeGroupVersion.WithResource("configmaps"),
+		GroupVersionKind: corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+		Scope:            meta.RESTScopeNamespace,
+	}
+	from := &resource.Info{Mapping: mapping, Namespace: "default", Name: "nginx-conf-1",
+		Object: newConfigMapWithRealname("nginx-conf-1", "nginx-conf", base)}
+	toObj := newConfigMapWithRealname("nginx-conf-2", "nginx-conf", base.Add(time.Hour))
+	_ = unstructured.SetNestedField(toObj.Object, "edited", "data", "test")
+	to := &resource.Info{Mapping: mapping, Namespace: "default", Name: "nginx-conf-2", Object: toObj}
+
+	streams, _, out, _ := genericclioptions.NewTestIOStreams()
+	err := diffGenerations(from, to, "nginx-conf", false, &diff.DiffProgram{Exec: executor, IOStreams: streams})
+	if exitErr, ok := err.(exec.ExitError); !ok || exitErr.ExitStatus() != 1 {
+		t.Fatalf("expected exit status 1 for the differences, got %v", err)
+	}
+
+	for _, expected := range []string{
+		"/v1.ConfigMap.default.nginx-conf\t",
+		"-  test: data",
+		"+  test: edited",
+		"-  name: nginx-conf-1",
+		"+  name: nginx-conf-2",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected %q in the diff, got:\n%s", expected, out.String())
+		}
+	}
+}
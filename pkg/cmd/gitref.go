@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitTree is the tree of a git revision extracted to a temporary directory.
+type gitTree struct {
+	// top is the top-level directory of the working copy.
+	top string
+	// dir is the directory the tree is extracted to.
+	dir string
+}
+
+// git runs git in the directory and returns its standard output.
+func git(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// extractGitTree extracts the whole tree of the revision of the repository containing
+// the path, so that kustomizations referring to files outside of their directories
+// can be built. Submodules are not included.
+func extractGitTree(ref, path string) (*gitTree, error) {
+	// The path may not exist in the working copy.
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	out, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	top := strings.TrimSpace(string(out))
+
+	// The ref is resolved first, so that a ref starting with "-" is not taken for an
+	// option of git archive.
+	out, err = git(top, "rev-parse", "--verify", "--end-of-options", ref+"^{tree}")
+	if err != nil {
+		return nil, err
+	}
+	treeHash := strings.TrimSpace(string(out))
+
+	out, err = git(top, "archive", "--format=tar", treeHash, "--")
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "realname-diff-"+filepath.Base(top)+"-")
+	if err != nil {
+		return nil, err
+	}
+	tree := &gitTree{top: top, dir: tmp}
+	if err := untar(bytes.NewReader(out), tmp); err != nil {
+		tree.remove()
+		return nil, err
+	}
+	return tree, nil
+}
+
+// untar extracts the regular files, the directories and the symbolic links in the
+// archive to the directory.
+func untar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, header.Name)
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in the archive: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, path)
+		case tar.TypeReg:
+			var f *os.File
+			f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0755|0600)
+			if err == nil {
+				_, err = io.Copy(f, tr)
+				if closeErr := f.Close(); err == nil {
+					err = closeErr
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// path returns the path in the tree corresponding to the path in the working copy.
+func (t *gitTree) path(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// The top-level directory given by git has no symbolic links.
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	} else if resolved, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		abs = filepath.Join(resolved, filepath.Base(abs))
+	}
+
+	rel, err := filepath.Rel(t.top, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%s is not in the git repository %s", path, t.top)
+	}
+
+	extracted := filepath.Join(t.dir, rel)
+	if _, err := os.Lstat(extracted); os.IsNotExist(err) {
+		return "", fmt.Errorf("%s does not exist in the git revision", path)
+	}
+	return extracted, nil
+}
+
+func (t *gitTree) remove() {
+	_ = os.RemoveAll(t.dir)
+}
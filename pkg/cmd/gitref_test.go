@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Test_extractGitTree tests reading a path at a git revision instead of the working copy
+func Test_extractGitTree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+	} {
+		if _, err := git(repo, args...); err != nil {
+			t.Fatalf("failed to set up the repository: %v", err)
+		}
+	}
+	overlay := filepath.Join(repo, "overlays", "prod")
+	if err := os.MkdirAll(overlay, 0755); err != nil {
+		t.Fatalf("failed to set up the repository: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(overlay, "kustomization.yaml"), []byte("committed\n"), 0644); err != nil {
+		t.Fatalf("failed to set up the repository: %v", err)
+	}
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"commit", "-q", "-m", "initial"},
+	} {
+		if _, err := git(repo, args...); err != nil {
+			t.Fatalf("failed to set up the repository: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(overlay, "kustomization.yaml"), []byte("modified\n"), 0644); err != nil {
+		t.Fatalf("failed to modify the working copy: %v", err)
+	}
+
+	tree, err := extractGitTree("HEAD", overlay)
+	if err != nil {
+		t.Fatalf("extractGitTree() returned error: %v", err)
+	}
+	defer tree.remove()
+
+	path, err := tree.path(overlay)
+	if err != nil {
+		t.Fatalf("path() returned error: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(path, "kustomization.yaml")); err != nil || string(data) != "committed\n" {
+		t.Errorf("expected the committed content, got %q (%v)", data, err)
+	}
+
+	if _, err := tree.path(filepath.Join(repo, "overlays", "staging")); err == nil {
+		t.Errorf("expected error for a path not in the revision but got nil")
+	}
+	if _, err := tree.path(t.TempDir()); err == nil {
+		t.Errorf("expected error for a path not in the repository but got nil")
+	}
+
+	if _, err := extractGitTree("--output="+filepath.Join(repo, "out.tar"), overlay); err == nil {
+		t.Errorf("expected error for a ref starting with \"-\" but got nil")
+	}
+	if _, err := os.Stat(filepath.Join(repo, "out.tar")); err == nil {
+		t.Errorf("expected the ref not to be taken for an option")
+	}
+}
+
+// Test_untar_invalidPath tests rejecting files outside of the directory
+func Test_untar_invalidPath(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "../escaped", Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+		t.Fatalf("failed to write the archive: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to write the archive: %v", err)
+	}
+
+	if err := untar(&buf, t.TempDir()); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
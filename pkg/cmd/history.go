@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+)
+
+var (
+	historyLong = `Lists all the live generations of a real name.
+
+For each live object having the real name, its name, creation timestamp, resource
+version, size in bytes and the workloads referencing it are printed, newest first.`
+
+	historyExample = `  # List the generations of the ConfigMap "nginx-conf"
+  kubectl realname-diff history configmap nginx-conf
+
+  # Print them in JSON
+  kubectl realname-diff history configmap nginx-conf -o json`
+)
+
+func NewCmdHistory(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewHistoryOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "history KIND REALNAME",
+		DisableFlagsInUseLine: true,
+		Short:                 "List all the live generations of a real name.",
+		Long:                  historyLong,
+		Example:               historyExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(options.Complete(factory, cmd, args))
+			cmdutil.CheckErr(options.Run())
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&options.output, "output", "o", options.output, "Output format. One of: (json).")
+
+	return cmd
+}
+
+type HistoryOptions struct {
+	kind     string
+	realname string
+	output   string
+
+	dynamicClient dynamic.Interface
+	cmdNamespace  string
+	builder       *resource.Builder
+	mapper        meta.RESTMapper
+
+	genericclioptions.IOStreams
+}
+
+func NewHistoryOptions(streams genericclioptions.IOStreams) *HistoryOptions {
+	return &HistoryOptions{
+		IOStreams: streams,
+	}
+}
+
+func (o *HistoryOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command, args []string) error {
+	var err error
+
+	if len(args) != 2 {
+		return cmdutil.UsageErrorf(cmd, "KIND and REALNAME are required")
+	}
+	o.kind, o.realname = args[0], args[1]
+
+	if o.output != "" && o.output != "json" {
+		return fmt.Errorf("--output must be either empty or \"json\"")
+	}
+
+	o.dynamicClient, err = factory.DynamicClient()
+	if err != nil {
+		return err
+	}
+
+	o.cmdNamespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.builder = factory.NewBuilder()
+
+	o.mapper, err = factory.ToRESTMapper()
+	return err
+}
+
+// historyEntry is a live generation of a real name.
+type historyEntry struct {
+	Name              string      `json:"name"`
+	Namespace         string      `json:"namespace,omitempty"`
+	CreationTimestamp metav1.Time `json:"creationTimestamp"`
+	ResourceVersion   string      `json:"resourceVersion"`
+	Size              int         `json:"size"`
+	ReferencedBy      []string    `json:"referencedBy"`
+}
+
+// history is the list of the live generations of a real name.
+type history struct {
+	Kind        string         `json:"kind"`
+	Realname    string         `json:"realname"`
+	Generations []historyEntry `json:"generations"`
+}
+
+// newHistory builds the history from the live objects having the real name, newest
+// first. refs holds the references of the live workloads.
+func newHistory(kind, realname string, objects []*unstructured.Unstructured, refs referenceIndex) (*history, error) {
+	h := &history{Kind: kind, Realname: realname, Generations: []historyEntry{}}
+	for _, obj := range objects {
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		h.Generations = append(h.Generations, historyEntry{
+			Name:              obj.GetName(),
+			Namespace:         obj.GetNamespace(),
+			CreationTimestamp: obj.GetCreationTimestamp(),
+			ResourceVersion:   obj.GetResourceVersion(),
+			Size:              len(data),
+			ReferencedBy:      append([]string{}, refs.referrers(kind, obj.GetNamespace(), obj.GetName())...),
+		})
+	}
+
+	sort.SliceStable(h.Generations, func(i, j int) bool {
+		return h.Generations[j].CreationTimestamp.Before(&h.Generations[i].CreationTimestamp)
+	})
+	return h, nil
+}
+
+// print prints the history as a table, or in JSON if output is "json".
+func (h *history) print(out io.Writer, output string) error {
+	if output == "json" {
+		data, err := json.MarshalIndent(h, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	}
+
+	w := printers.GetNewTabWriter(out)
+	fmt.Fprintln(w, "NAME\tCREATED\tRESOURCEVERSION\tSIZE\tREFERENCED BY")
+	for _, g := range h.Generations {
+		referencedBy := "<none>"
+		if len(g.ReferencedBy) > 0 {
+			referencedBy = strings.Join(g.ReferencedBy, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+			g.Name,
+			g.CreationTimestamp.UTC().Format(time.RFC3339),
+			g.ResourceVersion,
+			g.Size,
+			referencedBy,
+		)
+	}
+	return w.Flush()
+}
+
+// printNoGenerations tells that no generations are found, and prints an empty
+// history in JSON so that the output can still be parsed.
+func (o *HistoryOptions) printNoGenerations() error {
+	fmt.Fprintf(o.ErrOut, "No generations found for realname=%s.\n", o.realname)
+	if o.output != "json" {
+		return nil
+	}
+
+	gvk, err := o.mapper.KindFor(schema.ParseGroupResource(o.kind).WithVersion(""))
+	if err != nil {
+		return err
+	}
+	h, err := newHistory(gvk.Kind, o.realname, nil, nil)
+	if err != nil {
+		return err
+	}
+	return h.print(o.Out, o.output)
+}
+
+// visitGenerations visits the live objects of the kind having the real name.
+func visitGenerations(builder *resource.Builder, namespace, kind, realname string, fn resource.VisitorFunc) error {
+	r := builder.
+		Unstructured().
+		NamespaceParam(namespace).DefaultNamespace().
+		ResourceTypeOrNameArgs(true, kind).
+		LabelSelectorParam(realNameLabel + "=" + realname).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return err
+	}
+	return r.Visit(fn)
+}
+
+func (o *HistoryOptions) Run() error {
+	var kind string
+	var objects []*unstructured.Unstructured
+	refs := referenceIndex{}
+	listed := map[string]bool{}
+	err := visitGenerations(o.builder, o.cmdNamespace, o.kind, o.realname, func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		kind = info.Mapping.GroupVersionKind.Kind
+		objects = append(objects, info.Object.(*unstructured.Unstructured))
+
+		if isReferable(info.Mapping.GroupVersionKind) && !listed[info.Namespace] {
+			listed[info.Namespace] = true
+			return listWorkloadReferences(o.dynamicClient, info.Namespace, refs, nil)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(objects) == 0 {
+		return o.printNoGenerations()
+	}
+
+	h, err := newHistory(kind, o.realname, objects, refs)
+	if err != nil {
+		return err
+	}
+	return h.print(o.Out, o.output)
+}
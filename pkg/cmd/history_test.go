@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// Test_newHistory tests ordering the generations newest first with their referrers
+func Test_newHistory(t *testing.T) {
+	base := time.Date(2021, 12, 23, 15, 0, 0, 0, time.UTC)
+	objects := []*unstructured.Unstructured{
+		newConfigMapWithRealname("nginx-conf-1", "nginx-conf", base),
+		newConfigMapWithRealname("nginx-conf-3", "nginx-conf", base.Add(2*time.Hour)),
+		newConfigMapWithRealname("nginx-conf-2", "nginx-conf", base.Add(time.Hour)),
+	}
+	refs := referenceIndex{}
+	if err := refs.add(newWorkload("apps/v1", "Deployment", "nginx", newPodSpecWithConfigMapVolume("nginx-conf-3"))); err != nil {
+		t.Fatalf("add() returned error: %v", err)
+	}
+
+	h, err := newHistory("ConfigMap", "nginx-conf", objects, refs)
+	if err != nil {
+		t.Fatalf("newHistory() returned error: %v", err)
+	}
+
+	var names []string
+	for _, g := range h.Generations {
+		names = append(names, g.Name)
+		if g.Size <= 0 {
+			t.Errorf("%s: expected a positive size, got %d", g.Name, g.Size)
+		}
+	}
+	if expected := []string{"nginx-conf-3", "nginx-conf-2", "nginx-conf-1"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("generations = %v, want %v", names, expected)
+	}
+	if expected := []string{"Deployment/nginx"}; !reflect.DeepEqual(h.Generations[0].ReferencedBy, expected) {
+		t.Errorf("referencedBy = %v, want %v", h.Generations[0].ReferencedBy, expected)
+	}
+	if len(h.Generations[1].ReferencedBy) != 0 {
+		t.Errorf("expected no referrers, got %v", h.Generations[1].ReferencedBy)
+	}
+}
+
+// Test_history_print tests printing the history as a table and in JSON
+func Test_history_print(t *testing.T) {
+	created := time.Date(2021, 12, 23, 15, 0, 12, 0, time.UTC)
+	obj := newConfigMapWithRealname("nginx-conf-m5d2cggb7k", "nginx-conf", created)
+	obj.SetResourceVersion("1234")
+	refs := referenceIndex{}
+	if err := refs.add(newWorkload("apps/v1", "Deployment", "nginx", newPodSpecWithConfigMapVolume("nginx-conf-m5d2cggb7k"))); err != nil {
+		t.Fatalf("add() returned error: %v", err)
+	}
+	h, err := newHistory("ConfigMap", "nginx-conf", []*unstructured.Unstructured{obj}, refs)
+	if err != nil {
+		t.Fatalf("newHistory() returned error: %v", err)
+	}
+
+	t.Run("table", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := h.print(&out, ""); err != nil {
+			t.Fatalf("print() returned error: %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected a header and a row, got %q", out.String())
+		}
+		fields := strings.Fields(lines[1])
+		if len(fields) != 5 {
+			t.Fatalf("unexpected row: %q", lines[1])
+		}
+		if row := strings.Join([]string{fields[0], fields[1], fields[2], fields[4]}, " "); row != "nginx-conf-m5d2cggb7k 2021-12-23T15:00:12Z 1234 Deployment/nginx" {
+			t.Errorf("unexpected row: %q", lines[1])
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		if err := h.print(&out, "json"); err != nil {
+			t.Fatalf("print() returned error: %v", err)
+		}
+
+		var decoded history
+		if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+			t.Fatalf("output is not valid JSON: %v", err)
+		}
+		if decoded.Kind != "ConfigMap" || decoded.Realname != "nginx-conf" || len(decoded.Generations) != 1 {
+			t.Fatalf("unexpected history: %+v", decoded)
+		}
+		g := decoded.Generations[0]
+		if g.Name != "nginx-conf-m5d2cggb7k" || g.ResourceVersion != "1234" || !g.CreationTimestamp.Equal(&h.Generations[0].CreationTimestamp) {
+			t.Errorf("unexpected generation: %+v", g)
+		}
+	})
+}
+
+// Test_HistoryOptions_printNoGenerations tests printing an empty history in JSON if no generations are found
+func Test_HistoryOptions_printNoGenerations(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+
+	tests := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			name: "table",
+		},
+		{
+			name:     "json",
+			output:   "json",
+			expected: `{"kind":"ConfigMap","realname":"nginx-conf","generations":[]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streams, _, out, errOut := genericclioptions.NewTestIOStreams()
+			o := &HistoryOptions{kind: "configmap", realname: "nginx-conf", output: tt.output, mapper: mapper, IOStreams: streams}
+			if err := o.printNoGenerations(); err != nil {
+				t.Fatalf("printNoGenerations() returned error: %v", err)
+			}
+
+			if !strings.Contains(errOut.String(), "No generations found") {
+				t.Errorf("expected a message to stderr, got %q", errOut.String())
+			}
+			if len(tt.expected) == 0 {
+				if out.Len() != 0 {
+					t.Errorf("expected no output, got %q", out.String())
+				}
+				return
+			}
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, out.Bytes()); err != nil {
+				t.Fatalf("output is not valid JSON: %v", err)
+			}
+			if compacted.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, compacted.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/tools/clientcmd"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/utils/exec"
+)
+
+var (
+	lintLong = `Checks the real name labels of the input without a cluster.
+
+The following problems are reported:
+
+  duplicate-realname   Objects of the same kind in a namespace share a real name,
+                       so that they are compared with the same live object.
+  invalid-realname     The real name is not a valid label value, or is empty.
+  missing-realname     The name has a Kustomize hash suffix but no real name, so
+                       that the object is compared by its name, which changes
+                       with the content.
+  redundant-realname   The real name is the same as the name.
+
+Objects without a namespace are in the one given by --namespace, or "default".
+Exits with 1 if any problem is found.`
+
+	lintExample = `  # Check the real name labels of the kustomization
+  kubectl realname-diff lint -k ./example`
+)
+
+// lintRules are the rules of the problems reported by the lint command.
+const (
+	lintRuleDuplicateRealname = "duplicate-realname"
+	lintRuleInvalidRealname   = "invalid-realname"
+	lintRuleMissingRealname   = "missing-realname"
+	lintRuleRedundantRealname = "redundant-realname"
+)
+
+func NewCmdLint(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewLintOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "lint -f FILENAME",
+		DisableFlagsInUseLine: true,
+		Short:                 "Check the real name labels of the input without a cluster.",
+		Long:                  lintLong,
+		Example:               lintExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckDiffErr(options.Complete(factory))
+			cmdutil.CheckDiffErr(validateArgs(cmd, args))
+
+			if err := options.Run(); err != nil {
+				if exitErr := diffError(err); exitErr != nil {
+					os.Exit(exitErr.ExitStatus())
+				}
+				cmdutil.CheckDiffErr(err)
+			}
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&options.selector, "selector", "l", options.selector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmdutil.AddFilenameOptionFlags(cmd, &options.filenameOptions, "Contains the configuration to check")
+
+	return cmd
+}
+
+type LintOptions struct {
+	filenameOptions resource.FilenameOptions
+	selector        string
+
+	cmdNamespace string
+
+	genericclioptions.IOStreams
+}
+
+func NewLintOptions(streams genericclioptions.IOStreams) *LintOptions {
+	return &LintOptions{
+		IOStreams: streams,
+	}
+}
+
+func (o *LintOptions) Complete(factory cmdutil.Factory) error {
+	var err error
+
+	err = o.filenameOptions.RequireFilenameOrKustomize()
+	if err != nil {
+		return err
+	}
+
+	o.cmdNamespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if clientcmd.IsEmptyConfig(err) {
+		o.cmdNamespace, err = metav1.NamespaceDefault, nil
+	}
+	return err
+}
+
+// lintFinding is a problem of the real name label of an object.
+type lintFinding struct {
+	namespace string
+	kind      string
+	name      string
+	rule      string
+	message   string
+}
+
+// realnameDuplicate is a real name shared by objects of the same kind in a namespace.
+type realnameDuplicate struct {
+	key   objectKey
+	names []string
+}
+
+// findDuplicateRealnames returns the real names shared by objects of the same kind
+// in a namespace, in the order of appearance.
+func findDuplicateRealnames(objects []*unstructured.Unstructured) []realnameDuplicate {
+	var keys []objectKey
+	names := map[objectKey][]string{}
+	for _, obj := range objects {
+		key, ok := realnameKey(obj)
+		if !ok {
+			continue
+		}
+		if _, ok := names[key]; !ok {
+			keys = append(keys, key)
+		}
+		names[key] = append(names[key], obj.GetName())
+	}
+
+	var duplicates []realnameDuplicate
+	for _, key := range keys {
+		if len(names[key]) > 1 {
+			duplicates = append(duplicates, realnameDuplicate{key: key, names: names[key]})
+		}
+	}
+	return duplicates
+}
+
+// lintObjects checks the real name labels of the objects.
+func lintObjects(objects []*unstructured.Unstructured) []lintFinding {
+	var findings []lintFinding
+	report := func(obj *unstructured.Unstructured, rule, message string) {
+		findings = append(findings, lintFinding{
+			namespace: obj.GetNamespace(),
+			kind:      obj.GetKind(),
+			name:      obj.GetName(),
+			rule:      rule,
+			message:   message,
+		})
+	}
+
+	for _, obj := range objects {
+		name, ok := obj.GetLabels()[realNameLabel]
+		switch {
+		case !ok:
+			if hashSuffixPattern.MatchString(obj.GetName()) {
+				report(obj, lintRuleMissingRealname, "the name has a hash suffix but no real name")
+			}
+		case len(name) == 0:
+			report(obj, lintRuleInvalidRealname, "the real name is empty")
+		case len(validation.IsValidLabelValue(name)) > 0:
+			report(obj, lintRuleInvalidRealname, strings.Join(validation.IsValidLabelValue(name), "; "))
+		case name == obj.GetName():
+			report(obj, lintRuleRedundantRealname, "the real name is the same as the name")
+		}
+	}
+
+	for _, duplicate := range findDuplicateRealnames(objects) {
+		for _, obj := range objects {
+			if key, ok := realnameKey(obj); !ok || key != duplicate.key {
+				continue
+			}
+			var others []string
+			for _, name := range duplicate.names {
+				if name != obj.GetName() {
+					others = append(others, name)
+				}
+			}
+			report(obj, lintRuleDuplicateRealname, fmt.Sprintf("realname=%s is shared with %s", duplicate.key.name, strings.Join(others, ", ")))
+		}
+	}
+	return findings
+}
+
+func (o *LintOptions) Run() error {
+	objects, err := loadLocalObjects(&o.filenameOptions, o.selector)
+	if err != nil {
+		return err
+	}
+	defaultNamespaces(objects, o.cmdNamespace)
+
+	return printLintFindings(o.Out, lintObjects(objects))
+}
+
+// printLintFindings prints the findings, and returns an exit error with the status 1
+// if there are any.
+func printLintFindings(out io.Writer, findings []lintFinding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+
+	w := printers.GetNewTabWriter(out)
+	fmt.Fprintln(w, "NAMESPACE\tKIND\tNAME\tRULE\tMESSAGE")
+	for _, f := range findings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.namespace, f.kind, f.name, f.rule, f.message)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return exec.CodeExitError{Err: fmt.Errorf("%d problem(s) found", len(findings)), Code: 1}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/exec"
+)
+
+// Test_lintObjects tests reporting the problems of the real name labels
+func Test_lintObjects(t *testing.T) {
+	withLabels := func(obj *unstructured.Unstructured, labels map[string]string) *unstructured.Unstructured {
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	tests := []struct {
+		name     string
+		objects  []*unstructured.Unstructured
+		expected []string
+	}{
+		{
+			name: "no problems",
+			objects: []*unstructured.Unstructured{
+				newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now()),
+				withLabels(newConfigMapWithRealname("nginx", "", time.Now()), nil),
+			},
+		},
+		{
+			name: "duplicate real names",
+			objects: []*unstructured.Unstructured{
+				newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now()),
+				newConfigMapWithRealname("nginx-conf-bct5bfcfmg", "nginx-conf", time.Now()),
+				func() *unstructured.Unstructured {
+					obj := newConfigMapWithRealname("nginx-conf-k7mbh9mm68", "nginx-conf", time.Now())
+					obj.SetNamespace("other")
+					return obj
+				}(),
+			},
+			expected: []string{
+				"nginx-conf-bc58dhk76g duplicate-realname realname=nginx-conf is shared with nginx-conf-bct5bfcfmg",
+				"nginx-conf-bct5bfcfmg duplicate-realname realname=nginx-conf is shared with nginx-conf-bc58dhk76g",
+			},
+		},
+		{
+			name: "invalid real names",
+			objects: []*unstructured.Unstructured{
+				newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx conf", time.Now()),
+				newConfigMapWithRealname("nginx-conf-bct5bfcfmg", "", time.Now()),
+			},
+			expected: []string{
+				"nginx-conf-bc58dhk76g invalid-realname",
+				"nginx-conf-bct5bfcfmg invalid-realname the real name is empty",
+			},
+		},
+		{
+			name: "missing real name",
+			objects: []*unstructured.Unstructured{
+				withLabels(newConfigMapWithRealname("nginx-conf-bc58dhk76g", "", time.Now()), nil),
+			},
+			expected: []string{"nginx-conf-bc58dhk76g missing-realname the name has a hash suffix but no real name"},
+		},
+		{
+			name: "redundant real name",
+			objects: []*unstructured.Unstructured{
+				newConfigMapWithRealname("nginx-conf", "nginx-conf", time.Now()),
+			},
+			expected: []string{"nginx-conf redundant-realname the real name is the same as the name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := lintObjects(tt.objects)
+			var result []string
+			for _, f := range findings {
+				result = append(result, strings.Join([]string{f.name, f.rule, f.message}, " "))
+			}
+			if len(result) != len(tt.expected) {
+				t.Fatalf("lintObjects() = %v, want %v", result, tt.expected)
+			}
+			for i := range result {
+				if !strings.HasPrefix(result[i], tt.expected[i]) {
+					t.Errorf("lintObjects()[%d] = %q, want %q", i, result[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+// Test_findDuplicateRealnames tests grouping the names of the objects sharing a real name
+func Test_findDuplicateRealnames(t *testing.T) {
+	objects := []*unstructured.Unstructured{
+		newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now()),
+		newConfigMapWithRealname("htpasswd-k7mbh9mm68", "htpasswd", time.Now()),
+		newConfigMapWithRealname("nginx-conf-bct5bfcfmg", "nginx-conf", time.Now()),
+	}
+
+	duplicates := findDuplicateRealnames(objects)
+	if len(duplicates) != 1 {
+		t.Fatalf("expected 1 duplicate, got %v", duplicates)
+	}
+	if duplicates[0].key.name != "nginx-conf" || duplicates[0].key.namespace != "default" {
+		t.Errorf("unexpected key %v", duplicates[0].key)
+	}
+	if expected := []string{"nginx-conf-bc58dhk76g", "nginx-conf-bct5bfcfmg"}; !reflect.DeepEqual(duplicates[0].names, expected) {
+		t.Errorf("names = %v, want %v", duplicates[0].names, expected)
+	}
+}
+
+// Test_printLintFindings tests exiting with 1 if any problem is found
+func Test_printLintFindings(t *testing.T) {
+	var out bytes.Buffer
+	if err := printLintFindings(&out, nil); err != nil || out.Len() != 0 {
+		t.Errorf("expected nothing without findings, got %q (%v)", out.String(), err)
+	}
+
+	err := printLintFindings(&out, []lintFinding{
+		{namespace: "default", kind: "ConfigMap", name: "nginx-conf", rule: lintRuleRedundantRealname, message: "the real name is the same as the name"},
+	})
+	if exitErr, ok := err.(exec.ExitError); !ok || exitErr.ExitStatus() != 1 {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+	if !strings.Contains(out.String(), "redundant-realname") {
+		t.Errorf("expected the finding in the output, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,333 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/kubectl/pkg/cmd/diff"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/utils/exec"
+	"sigs.k8s.io/kustomize/api/konfig"
+)
+
+var (
+	localLong = `Diffs two local configurations without a cluster.
+
+Each of --from and --to is a directory containing a kustomization, which is built
+as with -k, or a file or a directory of manifests, which is read as with -f.
+Objects having the same real name and kind in the same namespace are compared
+with each other, and the other objects are compared by kind, namespace and name.
+Objects without a namespace are in the one given by --namespace, or "default".
+
+With --git-ref, --from is read from the git revision instead of the working copy,
+and defaults to the same path as --to. The whole tree of the revision is used, so
+kustomizations referring to files in other directories are built as they were.`
+
+	localExample = `  # Diff the objects of two overlays
+  kubectl realname-diff local --from ./overlays/staging --to ./overlays/prod
+
+  # Diff two rendered manifests
+  kubectl realname-diff local --from old.yaml --to new.yaml
+
+  # Diff an overlay at the main branch and in the working copy
+  kubectl realname-diff local --git-ref main --to ./overlays/prod`
+)
+
+func NewCmdLocal(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewLocalOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "local --from DIR|FILE --to DIR|FILE [--git-ref REF]",
+		DisableFlagsInUseLine: true,
+		Short:                 "Diff two local configurations without a cluster.",
+		Long:                  localLong,
+		Example:               localExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckDiffErr(options.Complete(factory))
+			cmdutil.CheckDiffErr(validateArgs(cmd, args))
+
+			if err := options.Run(); err != nil {
+				if exitErr := diffError(err); exitErr != nil {
+					os.Exit(exitErr.ExitStatus())
+				}
+				cmdutil.CheckDiffErr(err)
+			}
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&options.from, "from", options.from, "Kustomization directory, file or directory of manifests to diff from.")
+	cmd.Flags().StringVar(&options.to, "to", options.to, "Kustomization directory, file or directory of manifests to diff to.")
+	cmd.Flags().StringVar(&options.gitRef, "git-ref", options.gitRef, "If set, read --from at the git revision of the repository containing the current directory. --from defaults to --to.")
+	cmd.Flags().BoolVarP(&options.recursive, "recursive", "R", options.recursive, "Process the directories of manifests given by --from and --to recursively.")
+	cmd.Flags().StringVarP(&options.selector, "selector", "l", options.selector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.Flags().BoolVar(&options.showManagedFields, "show-managed-fields", options.showManagedFields, "If true, include managed fields in the diff.")
+
+	return cmd
+}
+
+type LocalOptions struct {
+	from      string
+	to        string
+	gitRef    string
+	recursive bool
+	selector  string
+
+	showManagedFields bool
+
+	cmdNamespace string
+	diffProgram  *diff.DiffProgram
+}
+
+func NewLocalOptions(streams genericclioptions.IOStreams) *LocalOptions {
+	return &LocalOptions{
+		diffProgram: &diff.DiffProgram{
+			Exec:      exec.New(),
+			IOStreams: streams,
+		},
+	}
+}
+
+func (o *LocalOptions) Complete(factory cmdutil.Factory) error {
+	var err error
+
+	if len(o.gitRef) > 0 && len(o.from) == 0 {
+		o.from = o.to
+	}
+	if len(o.from) == 0 || len(o.to) == 0 {
+		return fmt.Errorf("both --from and --to are required")
+	}
+	if len(o.gitRef) > 0 && o.from == "-" {
+		return fmt.Errorf("--from cannot be the standard input with --git-ref")
+	}
+
+	o.cmdNamespace, _, err = factory.ToRawKubeConfigLoader().Namespace()
+	if clientcmd.IsEmptyConfig(err) {
+		o.cmdNamespace, err = metav1.NamespaceDefault, nil
+	}
+	return err
+}
+
+// localFilenameOptions returns the options to read the path with: as -k if it is a
+// directory containing a kustomization, as -f otherwise.
+func localFilenameOptions(path string, recursive bool) *resource.FilenameOptions {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if _, err := os.Stat(filepath.Join(path, name)); err == nil {
+			return &resource.FilenameOptions{Kustomize: path}
+		}
+	}
+	return &resource.FilenameOptions{Filenames: []string{path}, Recursive: recursive}
+}
+
+// loadLocalObjects reads the objects of the configuration without a cluster.
+func loadLocalObjects(options *resource.FilenameOptions, selector string) ([]*unstructured.Unstructured, error) {
+	r := resource.NewLocalBuilder().
+		Unstructured().
+		FilenameParam(false, options).
+		LabelSelectorParam(selector).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	var objects []*unstructured.Unstructured
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		objects = append(objects, info.Object.(*unstructured.Unstructured))
+		return nil
+	})
+	return objects, err
+}
+
+// defaultNamespaces sets the namespace to the objects of namespaced kinds without
+// one. Without a cluster, the scope of kinds is taken from the
+// CustomResourceDefinitions in the objects, or from the known built-in kinds.
+func defaultNamespaces(objects []*unstructured.Unstructured, namespace string) {
+	crds := map[schema.GroupKind]crdKind{}
+	for _, obj := range objects {
+		if gk, kind, ok := crdKindOf(obj); ok {
+			crds[gk] = kind
+		}
+	}
+
+	for _, obj := range objects {
+		if len(obj.GetNamespace()) > 0 {
+			continue
+		}
+		gk := obj.GroupVersionKind().GroupKind()
+		if crd, ok := crds[gk]; (ok && !crd.namespaced) || (!ok && clusterScopedKinds[gk]) {
+			continue
+		}
+		obj.SetNamespace(namespace)
+	}
+}
+
+// localPair is a pair of objects to compare. Either side is nil if the object exists
+// only on the other side.
+type localPair struct {
+	from *unstructured.Unstructured
+	to   *unstructured.Unstructured
+
+	// name is the real name prefixed with realnamePairPrefix if the objects are
+	// paired by it, the name otherwise.
+	name string
+}
+
+// realnamePairPrefix is prepended to the real names of the pairs, so that their diff
+// files are not overwritten by the ones of an object named the same as the real
+// name. Object names never contain "_".
+const realnamePairPrefix = "realname_"
+
+// realnameKey returns the key of the object by its real name, or false if it has
+// none.
+func realnameKey(obj *unstructured.Unstructured) (objectKey, bool) {
+	name := realName(obj)
+	if len(name) == 0 {
+		return objectKey{}, false
+	}
+	return objectKey{groupKind: obj.GroupVersionKind().GroupKind(), namespace: obj.GetNamespace(), name: name}, true
+}
+
+// indexByRealname indexes the objects having a real name. A real name must not be
+// shared by objects of the same kind in a namespace, since the pairs would be
+// ambiguous.
+func indexByRealname(objects []*unstructured.Unstructured, side string) (map[objectKey]*unstructured.Unstructured, error) {
+	index := map[objectKey]*unstructured.Unstructured{}
+	for _, obj := range objects {
+		key, ok := realnameKey(obj)
+		if !ok {
+			continue
+		}
+		if other, ok := index[key]; ok {
+			return nil, fmt.Errorf("%s has multiple %s objects with realname=%s in namespace %q: %s and %s",
+				side, key.groupKind, key.name, key.namespace, other.GetName(), obj.GetName())
+		}
+		index[key] = obj
+	}
+	return index, nil
+}
+
+// pairObjects pairs the objects of the two sides by real name, falling back to
+// kind, namespace and name.
+func pairObjects(from, to []*unstructured.Unstructured) ([]localPair, error) {
+	if _, err := indexByRealname(from, "--from"); err != nil {
+		return nil, err
+	}
+	toByRealname, err := indexByRealname(to, "--to")
+	if err != nil {
+		return nil, err
+	}
+
+	toByName := map[objectKey]*unstructured.Unstructured{}
+	for _, obj := range to {
+		toByName[objectKey{groupKind: obj.GroupVersionKind().GroupKind(), namespace: obj.GetNamespace(), name: obj.GetName()}] = obj
+	}
+
+	var pairs []localPair
+	paired := map[*unstructured.Unstructured]bool{}
+	for _, obj := range from {
+		if key, ok := realnameKey(obj); ok {
+			if other, ok := toByRealname[key]; ok {
+				pairs = append(pairs, localPair{from: obj, to: other, name: realnamePairPrefix + key.name})
+				paired[other] = true
+				continue
+			}
+		}
+
+		key := objectKey{groupKind: obj.GroupVersionKind().GroupKind(), namespace: obj.GetNamespace(), name: obj.GetName()}
+		if other, ok := toByName[key]; ok && !paired[other] {
+			pairs = append(pairs, localPair{from: obj, to: other, name: key.name})
+			paired[other] = true
+			continue
+		}
+		pairs = append(pairs, localPair{from: obj, name: key.name})
+	}
+
+	for _, obj := range to {
+		if !paired[obj] {
+			pairs = append(pairs, localPair{to: obj, name: obj.GetName()})
+		}
+	}
+	return pairs, nil
+}
+
+func (o *LocalOptions) Run() error {
+	fromPath := o.from
+	if len(o.gitRef) > 0 {
+		tree, err := extractGitTree(o.gitRef, o.from)
+		if err != nil {
+			return err
+		}
+		defer tree.remove()
+
+		fromPath, err = tree.path(o.from)
+		if err != nil {
+			return err
+		}
+	}
+
+	from, err := loadLocalObjects(localFilenameOptions(fromPath, o.recursive), o.selector)
+	if err != nil {
+		return err
+	}
+	to, err := loadLocalObjects(localFilenameOptions(o.to, o.recursive), o.selector)
+	if err != nil {
+		return err
+	}
+	defaultNamespaces(append(append([]*unstructured.Unstructured{}, from...), to...), o.cmdNamespace)
+
+	pairs, err := pairObjects(from, to)
+	if err != nil {
+		return err
+	}
+
+	// The differ only knows these versions, which are the older and the newer
+	// sides of pairObject.
+	differ, err := diff.NewDiffer("LIVE", "MERGED")
+	if err != nil {
+		return err
+	}
+	defer differ.TearDown()
+
+	printer := diff.Printer{}
+	for _, pair := range pairs {
+		side := pair.to
+		if side == nil {
+			side = pair.from
+		}
+		// Both sides are named after the pair so that they are compared, by kind,
+		// namespace and the real name or the name.
+		name := diff.InfoObject{Info: &resource.Info{
+			Mapping:   &meta.RESTMapping{GroupVersionKind: side.GroupVersionKind()},
+			Namespace: side.GetNamespace(),
+			Name:      pair.name,
+		}}.Name()
+
+		if pair.to == nil {
+			if err := printDeleted(differ, name, pair.from.DeepCopy(), printer, o.showManagedFields); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := differ.Diff(pairObject{from: pair.from, to: pair.to, name: name}, printer, o.showManagedFields); err != nil {
+			return err
+		}
+	}
+
+	return differ.Run(o.diffProgram)
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Test_localFilenameOptions tests reading directories containing a kustomization with -k and the others with -f
+func Test_localFilenameOptions(t *testing.T) {
+	kustomization := t.TempDir()
+	if err := os.WriteFile(filepath.Join(kustomization, "kustomization.yaml"), []byte("resources: []\n"), 0644); err != nil {
+		t.Fatalf("failed to write the kustomization: %v", err)
+	}
+	manifests := t.TempDir()
+
+	if options := localFilenameOptions(kustomization, false); options.Kustomize != kustomization || len(options.Filenames) != 0 {
+		t.Errorf("expected -k %s, got %+v", kustomization, options)
+	}
+	if options := localFilenameOptions(manifests, true); len(options.Kustomize) != 0 || len(options.Filenames) != 1 || !options.Recursive {
+		t.Errorf("expected -f %s -R, got %+v", manifests, options)
+	}
+}
+
+// Test_defaultNamespaces tests setting the namespace only to the objects of namespaced kinds
+func Test_defaultNamespaces(t *testing.T) {
+	configMap := newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", time.Now())
+	configMap.SetNamespace("")
+	other := newConfigMapWithRealname("nginx-conf-def", "nginx-conf", time.Now())
+	other.SetNamespace("other")
+	clusterRole := &unstructured.Unstructured{}
+	clusterRole.SetAPIVersion("rbac.authorization.k8s.io/v1")
+	clusterRole.SetKind("ClusterRole")
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	_ = unstructured.SetNestedField(crd.Object, "cert-manager.io", "spec", "group")
+	_ = unstructured.SetNestedField(crd.Object, "Cluster", "spec", "scope")
+	_ = unstructured.SetNestedField(crd.Object, "ClusterIssuer", "spec", "names", "kind")
+	_ = unstructured.SetNestedField(crd.Object, "clusterissuers", "spec", "names", "plural")
+	issuer := &unstructured.Unstructured{}
+	issuer.SetAPIVersion("cert-manager.io/v1")
+	issuer.SetKind("ClusterIssuer")
+
+	defaultNamespaces([]*unstructured.Unstructured{configMap, other, clusterRole, crd, issuer}, "default")
+
+	for _, tt := range []struct {
+		obj      *unstructured.Unstructured
+		expected string
+	}{
+		{obj: configMap, expected: "default"},
+		{obj: other, expected: "other"},
+		{obj: clusterRole, expected: ""},
+		{obj: crd, expected: ""},
+		{obj: issuer, expected: ""},
+	} {
+		if ns := tt.obj.GetNamespace(); ns != tt.expected {
+			t.Errorf("%s: namespace = %q, want %q", tt.obj.GetKind(), ns, tt.expected)
+		}
+	}
+}
+
+// Test_pairObjects tests pairing the objects by real name, falling back to name
+func Test_pairObjects(t *testing.T) {
+	now := time.Now()
+	newConfigMap := func(name string) *unstructured.Unstructured {
+		cm := newConfigMapWithRealname(name, "", now)
+		cm.SetLabels(nil)
+		return cm
+	}
+
+	fromRenamed := newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", now)
+	toRenamed := newConfigMapWithRealname("nginx-conf-def", "nginx-conf", now)
+	fromSame := newConfigMap("app")
+	toSame := newConfigMap("app")
+	deleted := newConfigMap("deleted")
+	added := newConfigMap("added")
+	toOtherNamespace := newConfigMapWithRealname("nginx-conf-ghi", "nginx-conf", now)
+	toOtherNamespace.SetNamespace("other")
+
+	pairs, err := pairObjects(
+		[]*unstructured.Unstructured{fromRenamed, fromSame, deleted},
+		[]*unstructured.Unstructured{toSame, toRenamed, added, toOtherNamespace},
+	)
+	if err != nil {
+		t.Fatalf("pairObjects() returned error: %v", err)
+	}
+
+	expected := []localPair{
+		{from: fromRenamed, to: toRenamed, name: "realname_nginx-conf"},
+		{from: fromSame, to: toSame, name: "app"},
+		{from: deleted, name: "deleted"},
+		{to: added, name: "added"},
+		{to: toOtherNamespace, name: "nginx-conf-ghi"},
+	}
+	if len(pairs) != len(expected) {
+		t.Fatalf("expected %d pairs, got %d", len(expected), len(pairs))
+	}
+	for i := range expected {
+		if pairs[i] != expected[i] {
+			t.Errorf("pair %d = (%v, %v, %s), want (%v, %v, %s)", i,
+				pairs[i].from != nil, pairs[i].to != nil, pairs[i].name,
+				expected[i].from != nil, expected[i].to != nil, expected[i].name)
+		}
+	}
+}
+
+// Test_pairObjects_ambiguous tests rejecting a real name shared by objects on one side
+func Test_pairObjects_ambiguous(t *testing.T) {
+	now := time.Now()
+	to := []*unstructured.Unstructured{
+		newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", now),
+		newConfigMapWithRealname("nginx-conf-def", "nginx-conf", now),
+	}
+
+	if _, err := pairObjects(nil, to); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+// Test_pairObjects_realnameSameAsName tests naming the pairs distinctly when a real name is the name of another object
+func Test_pairObjects_realnameSameAsName(t *testing.T) {
+	now := time.Now()
+	named := newConfigMapWithRealname("app", "", now)
+	named.SetLabels(nil)
+
+	pairs, err := pairObjects(
+		[]*unstructured.Unstructured{newConfigMapWithRealname("app-abc", "app", now), named},
+		[]*unstructured.Unstructured{newConfigMapWithRealname("app-def", "app", now), named.DeepCopy()},
+	)
+	if err != nil {
+		t.Fatalf("pairObjects() returned error: %v", err)
+	}
+	if len(pairs) != 2 || pairs[0].name == pairs[1].name {
+		t.Errorf("expected 2 pairs with distinct names, got %+v", pairs)
+	}
+}
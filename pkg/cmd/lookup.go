@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// partialObjectMetadataListAccept asks the API server to return only the metadata of
+// the listed objects. Servers not supporting it fall back to the full objects.
+const partialObjectMetadataListAccept = "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1,application/json"
+
+// listPageSize is the maximum number of objects returned in a single list request.
+var listPageSize int64 = 500
+
+// realnameLookup holds the settings used to look up the live counterpart of a
+// local object by its real name.
+// The metadata of live objects having the real name label is listed once per
+// resource and namespace, and the result is shared among all the lookups. Only
+// the selected target is retrieved as a full object.
+//
+// Candidates of a namespaced object are looked up only in the namespace of the
+// object, which is resolved by the resource builder from the manifest or the
+// --namespace flag. Candidates of a cluster-scoped object are looked up across the
+// cluster, ignoring any namespace.
+type realnameLookup struct {
+	strategy      string
+	matchLabels   []string
+	allCandidates bool
+
+	// selector is the label selector given by the user, which the live candidates
+	// must also match.
+	selector string
+
+	// verboseOut receives the report of excluded candidates if it is not nil.
+	verboseOut io.Writer
+
+	// live provides the live objects instead of the cluster if it is not nil.
+	live liveSource
+
+	mu       sync.Mutex
+	indexes  map[indexKey]*realnameIndex
+	reported map[string]bool
+}
+
+// liveSource provides the live objects to compare with, instead of the cluster.
+type liveSource interface {
+	// list returns the metadata of the live objects matching the label selector in
+	// the scope of the info.
+	list(info *resource.Info, selector string) ([]metav1.PartialObjectMetadata, error)
+	// get returns the live object with the name in the scope of the info.
+	get(info *resource.Info, name string) (runtime.Object, error)
+}
+
+// indexKey identifies the scope of a list of live objects.
+type indexKey struct {
+	resource  schema.GroupVersionResource
+	namespace string
+}
+
+// realnameIndex holds the metadata of the live objects in a scope grouped by their
+// real names.
+type realnameIndex struct {
+	once  sync.Once
+	items map[string][]metav1.PartialObjectMetadata
+	err   error
+}
+
+// excludedReason returns the reason why the live object cannot be the comparison
+// target of the local object, or an empty string if it can be.
+// Objects being deleted and objects controlled by another object (e.g. copies made
+// by Helm or operators) are excluded unless allCandidates is set.
+func (l *realnameLookup) excludedReason(local, live metav1.Object) string {
+	if l.allCandidates {
+		return ""
+	}
+	if live.GetDeletionTimestamp() != nil {
+		return "terminating"
+	}
+	if ref := metav1.GetControllerOf(live); ref != nil {
+		if own := metav1.GetControllerOf(local); own == nil || own.UID != ref.UID {
+			return fmt.Sprintf("controlled by %s %s", ref.Kind, ref.Name)
+		}
+	}
+	return ""
+}
+
+// realNameSelector builds the label selector for the live candidates of the local
+// object. In addition to the real name label, the values of the matchLabels keys are
+// taken from the local object so that objects of other applications sharing the
+// same real name are excluded. Keys missing on the local object must also be
+// missing on the live objects.
+func realNameSelector(local runtime.Object, name string, matchLabels []string) (labels.Selector, error) {
+	r, err := labels.NewRequirement(realNameLabel, selection.Equals, []string{name})
+	if err != nil {
+		return nil, err
+	}
+	selector := labels.NewSelector().Add(*r)
+
+	localLabels := local.(*unstructured.Unstructured).GetLabels()
+	for _, key := range matchLabels {
+		if v, ok := localLabels[key]; ok {
+			r, err = labels.NewRequirement(key, selection.Equals, []string{v})
+		} else {
+			r, err = labels.NewRequirement(key, selection.DoesNotExist, nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(*r)
+	}
+	return selector, nil
+}
+
+// listMetadata lists the metadata of the live objects matching the label selector in
+// the scope of the info, following the continue tokens until all pages are read.
+func listMetadata(info *resource.Info, selector string) ([]metav1.PartialObjectMetadata, error) {
+	var items []metav1.PartialObjectMetadata
+	namespaced := info.Mapping.Scope.Name() == meta.RESTScopeNameNamespace
+
+	options := &metav1.ListOptions{
+		LabelSelector: selector,
+		Limit:         listPageSize,
+	}
+	for {
+		raw, err := info.Client.Get().
+			NamespaceIfScoped(info.Namespace, namespaced).
+			Resource(info.Mapping.Resource.Resource).
+			VersionedParams(options, metav1.ParameterCodec).
+			SetHeader("Accept", partialObjectMetadataListAccept).
+			Do(context.TODO()).
+			Raw()
+		if err != nil {
+			return nil, err
+		}
+
+		list := &metav1.PartialObjectMetadataList{}
+		if err := json.Unmarshal(raw, list); err != nil {
+			return nil, err
+		}
+		items = append(items, list.Items...)
+
+		if list.Continue == "" {
+			return items, nil
+		}
+		options.Continue = list.Continue
+	}
+}
+
+// scopeOf returns the scope in which the live candidates of the info are looked up.
+func scopeOf(info *resource.Info) indexKey {
+	if info.Mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return indexKey{resource: info.Mapping.Resource}
+	}
+	return indexKey{resource: info.Mapping.Resource, namespace: info.Namespace}
+}
+
+// index returns the metadata of the live objects having the real name label in the
+// scope of the info, grouped by their real names. The objects are listed on the
+// first call for each scope.
+func (l *realnameLookup) index(info *resource.Info) (map[string][]metav1.PartialObjectMetadata, error) {
+	key := scopeOf(info)
+
+	l.mu.Lock()
+	if l.indexes == nil {
+		l.indexes = map[indexKey]*realnameIndex{}
+	}
+	idx, ok := l.indexes[key]
+	if !ok {
+		idx = &realnameIndex{}
+		l.indexes[key] = idx
+	}
+	l.mu.Unlock()
+
+	idx.once.Do(func() {
+		selector := realNameLabel
+		if l.selector != "" {
+			selector += "," + l.selector
+		}
+
+		var items []metav1.PartialObjectMetadata
+		if l.live != nil {
+			items, idx.err = l.live.list(info, selector)
+		} else {
+			items, idx.err = listMetadata(info, selector)
+		}
+		if idx.err != nil {
+			return
+		}
+
+		idx.items = map[string][]metav1.PartialObjectMetadata{}
+		for _, item := range items {
+			name := item.GetLabels()[realNameLabel]
+			idx.items[name] = append(idx.items[name], item)
+		}
+	})
+
+	return idx.items, idx.err
+}
+
+// invalidate discards the listed objects in the scope of the info so that the next
+// lookup lists them again.
+func (l *realnameLookup) invalidate(info *resource.Info) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.indexes, scopeOf(info))
+}
+
+// candidates returns the metadata of the live objects which can be the comparison
+// target of the local object with the real name.
+func (l *realnameLookup) candidates(info *resource.Info, local *unstructured.Unstructured, name string) ([]metav1.PartialObjectMetadata, error) {
+	selector, err := realNameSelector(local, name, l.matchLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := l.index(info)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []metav1.PartialObjectMetadata
+	for _, item := range index[name] {
+		if !selector.Matches(labels.Set(item.GetLabels())) {
+			continue
+		}
+		if reason := l.excludedReason(local, &item); reason != "" {
+			l.report(fmt.Sprintf("Ignoring candidate %s %s for realname=%s: %s\n", info.Mapping.GroupVersionKind.Kind, item.GetName(), name, reason))
+			continue
+		}
+		candidates = append(candidates, item)
+	}
+	return candidates, nil
+}
+
+// report writes the message to verboseOut once, if verboseOut is set.
+func (l *realnameLookup) report(message string) {
+	if l.verboseOut == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reported[message] {
+		return
+	}
+	if l.reported == nil {
+		l.reported = map[string]bool{}
+	}
+	l.reported[message] = true
+	fmt.Fprint(l.verboseOut, message)
+}
+
+// getWithRealName retrieves the object from the `realname-diff/realname` label.
+// If the object is not found, it will try to retrieve it from the `metadata.name`.
+// The candidates are matched against the local object, since info.Object may hold
+// the live object of a previous attempt.
+func (l *realnameLookup) getWithRealName(info *resource.Info, local *unstructured.Unstructured, name string) error {
+	candidates, err := l.candidates(info, local, name)
+	if err != nil {
+		return err
+	}
+
+	// The target is retrieved by name: the one selected from the candidates, or the
+	// local object's real name if there are no candidates.
+	targetName := name
+
+	len := len(candidates)
+	switch {
+	case len > 1:
+		switch l.strategy {
+		case targetSelectionStrategyError:
+			return fmt.Errorf("multiple objects have same realname label: realname=%s", name)
+
+		case targetSelectionStrategyLatest:
+			// Initialize to first item, then find the one with latest timestamp
+			latest := candidates[0]
+			for i := 1; i < len; i++ {
+				if candidates[i].GetCreationTimestamp().After(latest.GetCreationTimestamp().Time) {
+					latest = candidates[i]
+				}
+			}
+			targetName = latest.GetName()
+		}
+
+	case len == 1:
+		targetName = candidates[0].GetName()
+
+	case l.selector != "":
+		// The object named the real name is not listed with the selector, so it is
+		// checked here, and taken for missing unless it matches.
+		target, err := l.fetch(info, name)
+		if err != nil {
+			return err
+		}
+		selector, err := labels.Parse(l.selector)
+		if err != nil {
+			return err
+		}
+		if !selector.Matches(labels.Set(target.(*unstructured.Unstructured).GetLabels())) {
+			l.report(fmt.Sprintf("Ignoring %s %s for realname=%s: not matching the selector\n", info.Mapping.GroupVersionKind.Kind, name, name))
+			return errors.NewNotFound(info.Mapping.Resource.GroupResource(), name)
+		}
+		setTarget(info, target)
+		return nil
+	}
+
+	return l.get(info, targetName)
+}
+
+// fetch retrieves the live object with the name in the scope of the info.
+func (l *realnameLookup) fetch(info *resource.Info, name string) (runtime.Object, error) {
+	if l.live != nil {
+		return l.live.get(info, name)
+	}
+	return resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, name)
+}
+
+// get retrieves the live object with the name in the scope of the info, and sets it
+// to info.Object.
+func (l *realnameLookup) get(info *resource.Info, name string) error {
+	target, err := l.fetch(info, name)
+	if err != nil {
+		return err
+	}
+
+	setTarget(info, target)
+	return nil
+}
+
+// setTarget sets the live object to info.Object.
+func setTarget(info *resource.Info, target runtime.Object) {
+	info.Object = target
+	info.ResourceVersion = target.(*unstructured.Unstructured).GetResourceVersion()
+}
@@ -0,0 +1,296 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/rest/fake"
+)
+
+// Test_realNameSelector tests the realNameSelector() function which builds the label selector for live candidates
+func Test_realNameSelector(t *testing.T) {
+	tests := []struct {
+		name        string
+		localLabels map[string]string
+		matchLabels []string
+		expected    string
+	}{
+		{
+			name:        "real name only",
+			localLabels: map[string]string{realNameLabel: "app-config"},
+			matchLabels: nil,
+			expected:    realNameLabel + "=app-config",
+		},
+		{
+			name:        "match label present on local object",
+			localLabels: map[string]string{realNameLabel: "app-config", "app.kubernetes.io/instance": "frontend"},
+			matchLabels: []string{"app.kubernetes.io/instance"},
+			expected:    "app.kubernetes.io/instance=frontend," + realNameLabel + "=app-config",
+		},
+		{
+			name:        "match label missing on local object",
+			localLabels: map[string]string{realNameLabel: "app-config"},
+			matchLabels: []string{"app.kubernetes.io/instance"},
+			expected:    "!app.kubernetes.io/instance," + realNameLabel + "=app-config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := realNameSelector(newUnstructuredWithLabels(tt.localLabels), "app-config", tt.matchLabels)
+			if err != nil {
+				t.Fatalf("realNameSelector() returned error: %v", err)
+			}
+			if selector.String() != tt.expected {
+				t.Errorf("realNameSelector() = %q, want %q", selector.String(), tt.expected)
+			}
+		})
+	}
+}
+
+// Test_realnameLookup_excludedReason tests which live objects are excluded from the real name candidates
+func Test_realnameLookup_excludedReason(t *testing.T) {
+	now := metav1.Now()
+	controller := true
+	ownerRef := metav1.OwnerReference{
+		APIVersion: "example.com/v1",
+		Kind:       "Release",
+		Name:       "my-release",
+		UID:        "owner-uid",
+		Controller: &controller,
+	}
+
+	tests := []struct {
+		name          string
+		allCandidates bool
+		mutateLive    func(*unstructured.Unstructured)
+		mutateLocal   func(*unstructured.Unstructured)
+		expected      string
+	}{
+		{
+			name:     "plain object is a candidate",
+			expected: "",
+		},
+		{
+			name:       "terminating object is excluded",
+			mutateLive: func(u *unstructured.Unstructured) { u.SetDeletionTimestamp(&now) },
+			expected:   "terminating",
+		},
+		{
+			name:       "object controlled by another object is excluded",
+			mutateLive: func(u *unstructured.Unstructured) { u.SetOwnerReferences([]metav1.OwnerReference{ownerRef}) },
+			expected:   "controlled by Release my-release",
+		},
+		{
+			name:        "object controlled by the same controller as the local object is a candidate",
+			mutateLive:  func(u *unstructured.Unstructured) { u.SetOwnerReferences([]metav1.OwnerReference{ownerRef}) },
+			mutateLocal: func(u *unstructured.Unstructured) { u.SetOwnerReferences([]metav1.OwnerReference{ownerRef}) },
+			expected:    "",
+		},
+		{
+			name:          "all candidates includes terminating object",
+			allCandidates: true,
+			mutateLive:    func(u *unstructured.Unstructured) { u.SetDeletionTimestamp(&now) },
+			expected:      "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newConfigMapWithRealname("nginx-conf-def456", "nginx-conf", time.Now())
+			live := newConfigMapWithRealname("nginx-conf-abc123", "nginx-conf", time.Now())
+			if tt.mutateLocal != nil {
+				tt.mutateLocal(local)
+			}
+			if tt.mutateLive != nil {
+				tt.mutateLive(live)
+			}
+
+			lookup := &realnameLookup{allCandidates: tt.allCandidates}
+			result := lookup.excludedReason(local, live)
+			if result != tt.expected {
+				t.Errorf("excludedReason() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+// Test_realnameLookup_getWithRealName_metadataOnly tests that candidates are listed as paginated metadata
+// and only the selected target is retrieved as a full object
+func Test_realnameLookup_getWithRealName_metadataOnly(t *testing.T) {
+	pages := map[string]string{
+		"": `{"kind":"PartialObjectMetadataList","apiVersion":"meta.k8s.io/v1","metadata":{"continue":"page2"},"items":[
+			{"metadata":{"name":"other-abc","namespace":"default","labels":{"` + realNameLabel + `":"other"}}}]}`,
+		"page2": `{"kind":"PartialObjectMetadataList","apiVersion":"meta.k8s.io/v1","metadata":{},"items":[
+			{"metadata":{"name":"nginx-conf-abc","namespace":"default","labels":{"` + realNameLabel + `":"nginx-conf"}}}]}`,
+	}
+
+	var gets []string
+	client := &fake.RESTClient{
+		NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+		GroupVersion:         corev1.SchemeGroupVersion,
+		Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+			header := http.Header{"Content-Type": []string{runtime.ContentTypeJSON}}
+
+			if req.URL.Path == "/namespaces/default/configmaps" {
+				if !strings.Contains(req.Header.Get("Accept"), "as=PartialObjectMetadataList") {
+					t.Errorf("expected metadata-only list request, got Accept: %q", req.Header.Get("Accept"))
+				}
+				if limit := req.URL.Query().Get("limit"); limit != strconv.FormatInt(listPageSize, 10) {
+					t.Errorf("expected limit %d, got %q", listPageSize, limit)
+				}
+				body := pages[req.URL.Query().Get("continue")]
+				return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+			}
+
+			gets = append(gets, req.URL.Path)
+			body := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"nginx-conf-abc","namespace":"default","resourceVersion":"42","labels":{"` + realNameLabel + `":"nginx-conf"}},"data":{"nginx.conf":"# test"}}`
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+		}),
+	}
+
+	info := &resource.Info{
+		Client: client,
+		Mapping: &meta.RESTMapping{
+			Resource:         corev1.SchemeGroupVersion.WithResource("configmaps"),
+			GroupVersionKind: corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+			Scope:            meta.RESTScopeNamespace,
+		},
+		Namespace: "default",
+		Object:    newConfigMapWithRealname("nginx-conf-def", "nginx-conf", time.Now()),
+	}
+
+	lookup := &realnameLookup{strategy: targetSelectionStrategyError}
+	if err := lookup.getWithRealName(info, info.Object.(*unstructured.Unstructured), "nginx-conf"); err != nil {
+		t.Fatalf("getWithRealName() returned error: %v", err)
+	}
+
+	if len(gets) != 1 || gets[0] != "/namespaces/default/configmaps/nginx-conf-abc" {
+		t.Errorf("expected only the target to be retrieved, got %v", gets)
+	}
+	if name := info.Object.(*unstructured.Unstructured).GetName(); name != "nginx-conf-abc" {
+		t.Errorf("expected target %q, got %q", "nginx-conf-abc", name)
+	}
+	if info.ResourceVersion != "42" {
+		t.Errorf("expected resource version %q, got %q", "42", info.ResourceVersion)
+	}
+}
+
+// Test_realnameLookup_index_scope tests the namespace and label selector of the candidate list requests
+func Test_realnameLookup_index_scope(t *testing.T) {
+	tests := []struct {
+		name             string
+		mapping          *meta.RESTMapping
+		namespace        string
+		selector         string
+		expectedPath     string
+		expectedSelector string
+	}{
+		{
+			name: "namespaced resource",
+			mapping: &meta.RESTMapping{
+				Resource: corev1.SchemeGroupVersion.WithResource("configmaps"),
+				Scope:    meta.RESTScopeNamespace,
+			},
+			namespace:        "team-a",
+			expectedPath:     "/namespaces/team-a/configmaps",
+			expectedSelector: realNameLabel,
+		},
+		{
+			name: "namespaced resource with user selector",
+			mapping: &meta.RESTMapping{
+				Resource: corev1.SchemeGroupVersion.WithResource("configmaps"),
+				Scope:    meta.RESTScopeNamespace,
+			},
+			namespace:        "team-a",
+			selector:         "env=prod",
+			expectedPath:     "/namespaces/team-a/configmaps",
+			expectedSelector: realNameLabel + ",env=prod",
+		},
+		{
+			name: "cluster-scoped resource ignores namespace",
+			mapping: &meta.RESTMapping{
+				Resource: rbacv1.SchemeGroupVersion.WithResource("clusterroles"),
+				Scope:    meta.RESTScopeRoot,
+			},
+			namespace:        "team-a",
+			expectedPath:     "/clusterroles",
+			expectedSelector: realNameLabel,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths, selectors []string
+			client := &fake.RESTClient{
+				NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+				Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+					paths = append(paths, req.URL.Path)
+					selectors = append(selectors, req.URL.Query().Get("labelSelector"))
+					body := `{"kind":"PartialObjectMetadataList","apiVersion":"meta.k8s.io/v1","metadata":{},"items":[]}`
+					header := http.Header{"Content-Type": []string{runtime.ContentTypeJSON}}
+					return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+				}),
+			}
+
+			lookup := &realnameLookup{selector: tt.selector}
+			info := &resource.Info{Client: client, Mapping: tt.mapping, Namespace: tt.namespace}
+			if _, err := lookup.index(info); err != nil {
+				t.Fatalf("index() returned error: %v", err)
+			}
+
+			if len(paths) != 1 || paths[0] != tt.expectedPath {
+				t.Errorf("expected a list request to %q, got %v", tt.expectedPath, paths)
+			}
+			if len(selectors) != 1 || selectors[0] != tt.expectedSelector {
+				t.Errorf("expected label selector %q, got %v", tt.expectedSelector, selectors)
+			}
+		})
+	}
+}
+
+// Test_RealnameDiffOptions_Run_enforceNamespace tests rejecting local objects in other namespaces than the explicit --namespace before any lookup
+func Test_RealnameDiffOptions_Run_enforceNamespace(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "local.yaml")
+	local := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-conf-new
+  namespace: team-b
+  labels:
+    realname-diff/realname: nginx-conf
+`
+	if err := os.WriteFile(filename, []byte(local), 0644); err != nil {
+		t.Fatalf("failed to write the input: %v", err)
+	}
+
+	streams, _, out, _ := genericclioptions.NewTestIOStreams()
+	o := NewRealnameDiffOptions(streams)
+	o.builder = resource.NewLocalBuilder()
+	o.live = newLiveSnapshot(t, snapshotYAML)
+	o.filenameOptions = resource.FilenameOptions{Filenames: []string{filename}}
+	o.cmdNamespace = "team-a"
+	o.enforceNamespace = true
+
+	err := o.Run()
+	if err == nil || !strings.Contains(err.Error(), `the namespace from the provided object "team-b" does not match the namespace "team-a"`) {
+		t.Errorf("expected the namespace conflict to be rejected, got %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no diff, got %q", out.String())
+	}
+}
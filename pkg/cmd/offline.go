@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// clusterScopedKinds are the built-in kinds which are not namespaced. Without a
+// cluster, the scope of the other kinds is taken from the CustomResourceDefinitions
+// and the objects in the snapshot, or they are assumed to be namespaced.
+var clusterScopedKinds = map[schema.GroupKind]bool{
+	{Kind: "Namespace"}:        true,
+	{Kind: "Node"}:             true,
+	{Kind: "PersistentVolume"}: true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                         true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                  true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                   true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                      true,
+	{Group: "storage.k8s.io", Kind: "CSINode"}:                                        true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                               true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                               true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                      true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                                true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:                 true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                             true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}:   true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:     true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"}:        true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"}: true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:                 true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"}:                       true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"}:       true,
+}
+
+// liveSnapshot is a liveSource serving the objects read from a directory, such as
+// one written by "kubectl realname-diff snapshot".
+type liveSnapshot struct {
+	objects map[objectKey]*unstructured.Unstructured
+	crds    map[schema.GroupKind]crdKind
+
+	// namespaced records whether the objects of each kind in the snapshot have a
+	// namespace.
+	namespaced map[schema.GroupKind]bool
+}
+
+var _ liveSource = &liveSnapshot{}
+
+// loadLiveSnapshot reads the objects in the files under the directory.
+func loadLiveSnapshot(dir string) (*liveSnapshot, error) {
+	s := &liveSnapshot{
+		objects:    map[objectKey]*unstructured.Unstructured{},
+		crds:       map[schema.GroupKind]crdKind{},
+		namespaced: map[schema.GroupKind]bool{},
+	}
+
+	r := resource.NewLocalBuilder().
+		Unstructured().
+		FilenameParam(false, &resource.FilenameOptions{Filenames: []string{dir}, Recursive: true}).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+
+		obj := info.Object.(*unstructured.Unstructured)
+		gk := obj.GroupVersionKind().GroupKind()
+		key := objectKey{groupKind: gk, namespace: obj.GetNamespace(), name: obj.GetName()}
+		if _, ok := s.objects[key]; ok {
+			return fmt.Errorf("%s %q is duplicated in %s", gk, obj.GetName(), dir)
+		}
+		s.objects[key] = obj
+		s.namespaced[gk] = len(obj.GetNamespace()) > 0
+
+		if crdGK, kind, ok := crdKindOf(obj); ok {
+			s.crds[crdGK] = kind
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// mappingFor returns the mapping of the kind, guessed without a cluster.
+func (s *liveSnapshot) mappingFor(gvk schema.GroupVersionKind) *meta.RESTMapping {
+	gk := gvk.GroupKind()
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	mapping := &meta.RESTMapping{
+		Resource:         plural,
+		GroupVersionKind: gvk,
+		Scope:            meta.RESTScopeNamespace,
+	}
+
+	if crd, ok := s.crds[gk]; ok {
+		mapping.Resource = gvk.GroupVersion().WithResource(crd.resource)
+		if !crd.namespaced {
+			mapping.Scope = meta.RESTScopeRoot
+		}
+	} else if namespaced, ok := s.namespaced[gk]; clusterScopedKinds[gk] || (ok && !namespaced) {
+		mapping.Scope = meta.RESTScopeRoot
+	}
+	return mapping
+}
+
+// addInputCRDs records the kinds defined by the CustomResourceDefinitions in the
+// input, so that the scopes of the custom resources are known even if the
+// definitions are not in the snapshot yet.
+func (s *liveSnapshot) addInputCRDs(infos []*resource.Info) {
+	for _, info := range infos {
+		gk, kind, ok := crdKindOf(info.Object.(*unstructured.Unstructured))
+		if _, found := s.crds[gk]; !ok || found {
+			continue
+		}
+		s.crds[gk] = kind
+	}
+}
+
+// resolve sets the mapping of the local object of the info, and defaults its
+// namespace as the builder does with a cluster.
+func (s *liveSnapshot) resolve(info *resource.Info, namespace string) {
+	obj := info.Object.(*unstructured.Unstructured)
+	info.Mapping = s.mappingFor(obj.GroupVersionKind())
+
+	if info.Mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		info.Namespace = ""
+		return
+	}
+	if len(info.Namespace) == 0 {
+		info.Namespace = namespace
+		obj.SetNamespace(namespace)
+	}
+}
+
+func (s *liveSnapshot) list(info *resource.Info, selector string) ([]metav1.PartialObjectMetadata, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := scopeOf(info)
+	var items []metav1.PartialObjectMetadata
+	for key, obj := range s.objects {
+		if key.groupKind != info.Mapping.GroupVersionKind.GroupKind() || key.namespace != scope.namespace {
+			continue
+		}
+		if !parsed.Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+
+		item := metav1.PartialObjectMetadata{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].GetName() < items[j].GetName()
+	})
+	return items, nil
+}
+
+func (s *liveSnapshot) get(info *resource.Info, name string) (runtime.Object, error) {
+	key := objectKey{groupKind: info.Mapping.GroupVersionKind.GroupKind(), namespace: scopeOf(info).namespace, name: name}
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, errors.NewNotFound(info.Mapping.Resource.GroupResource(), name)
+	}
+	return obj.DeepCopy(), nil
+}
+
+// serverFields are the fields maintained by the server, which are kept from the live
+// object when merging without a cluster.
+var serverFields = [][]string{
+	{"metadata", "uid"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "generation"},
+	{"metadata", "managedFields"},
+	{"status"},
+}
+
+// offlineMerged returns the local object as the merged object, with the fields
+// maintained by the server taken from the live object. Server-side defaulting is
+// not applied. live is nil if there is no live object.
+func offlineMerged(local, live *unstructured.Unstructured) *unstructured.Unstructured {
+	merged := local.DeepCopy()
+	deleteLastApplied(merged)
+	if live == nil {
+		return merged
+	}
+
+	for _, field := range serverFields {
+		if value, ok, _ := unstructured.NestedFieldCopy(live.Object, field...); ok {
+			_ = unstructured.SetNestedField(merged.Object, value, field...)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+const snapshotYAML = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-conf-old
+  namespace: default
+  uid: old-uid
+  resourceVersion: "42"
+  creationTimestamp: "2021-12-20T09:12:45Z"
+  labels:
+    realname-diff/realname: nginx-conf
+    app: nginx
+data:
+  nginx.conf: old
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-conf-other
+  namespace: other
+  labels:
+    realname-diff/realname: nginx-conf
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: clusterissuers.cert-manager.io
+spec:
+  group: cert-manager.io
+  scope: Cluster
+  names:
+    kind: ClusterIssuer
+    plural: clusterissuers
+  versions:
+  - name: v1
+    served: true
+`
+
+// newLiveSnapshot writes the YAML to a directory and loads it as a snapshot
+func newLiveSnapshot(t *testing.T, yaml string) *liveSnapshot {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "live.yaml"), []byte(yaml), 0644); err != nil {
+		t.Fatalf("failed to write the snapshot: %v", err)
+	}
+
+	s, err := loadLiveSnapshot(dir)
+	if err != nil {
+		t.Fatalf("loadLiveSnapshot() returned error: %v", err)
+	}
+	return s
+}
+
+// Test_loadLiveSnapshot_duplicated tests rejecting a snapshot having the same object twice
+func Test_loadLiveSnapshot_duplicated(t *testing.T) {
+	dir := t.TempDir()
+	yaml := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: default\n"
+	for _, name := range []string{"a.yaml", "b.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(yaml), 0644); err != nil {
+			t.Fatalf("failed to write the snapshot: %v", err)
+		}
+	}
+
+	if _, err := loadLiveSnapshot(dir); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
+
+// Test_liveSnapshot_mappingFor tests guessing the scope of kinds without a cluster
+func Test_liveSnapshot_mappingFor(t *testing.T) {
+	s := newLiveSnapshot(t, snapshotYAML)
+	s.addInputCRDs([]*resource.Info{
+		{Object: newCRD("example.com", "Gadget", "gadgets", "Cluster", "v1")},
+		{Object: newCRD("cert-manager.io", "ClusterIssuer", "clusterissuers", "Namespaced", "v1")},
+		{Object: newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now())},
+	})
+
+	tests := []struct {
+		name             string
+		gvk              schema.GroupVersionKind
+		expectedResource string
+		expectedScope    meta.RESTScopeName
+	}{
+		{
+			name:             "namespaced built-in kind",
+			gvk:              schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			expectedResource: "configmaps",
+			expectedScope:    meta.RESTScopeNameNamespace,
+		},
+		{
+			name:             "cluster-scoped built-in kind",
+			gvk:              schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+			expectedResource: "clusterroles",
+			expectedScope:    meta.RESTScopeNameRoot,
+		},
+		{
+			name:             "custom resource defined in the snapshot",
+			gvk:              schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "ClusterIssuer"},
+			expectedResource: "clusterissuers",
+			expectedScope:    meta.RESTScopeNameRoot,
+		},
+		{
+			name:             "custom resource defined in the input",
+			gvk:              schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Gadget"},
+			expectedResource: "gadgets",
+			expectedScope:    meta.RESTScopeNameRoot,
+		},
+		{
+			name:             "unknown kind",
+			gvk:              schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"},
+			expectedResource: "widgets",
+			expectedScope:    meta.RESTScopeNameNamespace,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping := s.mappingFor(tt.gvk)
+			if mapping.Resource.Resource != tt.expectedResource {
+				t.Errorf("resource = %q, want %q", mapping.Resource.Resource, tt.expectedResource)
+			}
+			if mapping.Scope.Name() != tt.expectedScope {
+				t.Errorf("scope = %q, want %q", mapping.Scope.Name(), tt.expectedScope)
+			}
+		})
+	}
+}
+
+// Test_realnameLookup_getWithRealName_offline tests matching by real name against the objects in a snapshot
+func Test_realnameLookup_getWithRealName_offline(t *testing.T) {
+	s := newLiveSnapshot(t, snapshotYAML)
+
+	local := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now())
+	local.SetNamespace("")
+	info := &resource.Info{Name: local.GetName(), Object: local}
+	s.resolve(info, "default")
+	if info.Namespace != "default" || local.GetNamespace() != "default" {
+		t.Fatalf("expected the namespace to be defaulted, got %q", info.Namespace)
+	}
+
+	lookup := &realnameLookup{strategy: targetSelectionStrategyError, live: s}
+	// The second attempt is made with info.Object holding the live object, as in the
+	// retries of a conflict.
+	for i := 0; i < 2; i++ {
+		if err := lookup.getWithRealName(info, local, "nginx-conf"); err != nil {
+			t.Fatalf("getWithRealName() returned error: %v", err)
+		}
+		if name := info.Object.(*unstructured.Unstructured).GetName(); name != "nginx-conf-old" {
+			t.Errorf("expected target %q, got %q", "nginx-conf-old", name)
+		}
+		if info.ResourceVersion != "42" {
+			t.Errorf("expected resource version %q, got %q", "42", info.ResourceVersion)
+		}
+	}
+
+	if err := lookup.get(info, "missing"); !isNotFound(err) {
+		t.Errorf("expected NotFound, got %v", err)
+	}
+}
+
+// Test_realnameLookup_getWithRealName_selector tests comparing the object named the real name only if it matches the selector
+func Test_realnameLookup_getWithRealName_selector(t *testing.T) {
+	s := newLiveSnapshot(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: nginx-conf
+  namespace: default
+  labels:
+    env: staging
+`)
+
+	tests := []struct {
+		name          string
+		selector      string
+		expectMissing bool
+	}{
+		{
+			name: "without a selector",
+		},
+		{
+			name:     "matching the selector",
+			selector: "env=staging",
+		},
+		{
+			name:          "not matching the selector",
+			selector:      "env=prod",
+			expectMissing: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now())
+			info := &resource.Info{Name: local.GetName(), Object: local}
+			s.resolve(info, "default")
+
+			lookup := &realnameLookup{strategy: targetSelectionStrategyError, selector: tt.selector, live: s}
+			err := lookup.getWithRealName(info, local, "nginx-conf")
+			if tt.expectMissing {
+				if !isNotFound(err) {
+					t.Errorf("expected NotFound, got %v", err)
+				}
+				if info.Object != local {
+					t.Errorf("expected the local object to be kept")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getWithRealName() returned error: %v", err)
+			}
+			if name := info.Object.(*unstructured.Unstructured).GetName(); name != "nginx-conf" {
+				t.Errorf("expected target %q, got %q", "nginx-conf", name)
+			}
+		})
+	}
+}
+
+// Test_offlineMerged tests taking the fields maintained by the server from the live object
+func Test_offlineMerged(t *testing.T) {
+	s := newLiveSnapshot(t, snapshotYAML)
+	live := s.objects[objectKey{groupKind: schema.GroupKind{Kind: "ConfigMap"}, namespace: "default", name: "nginx-conf-old"}]
+
+	local := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now())
+	unstructured.RemoveNestedField(local.Object, "metadata", "creationTimestamp")
+	local.SetAnnotations(map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"})
+
+	merged := offlineMerged(local, live)
+	if merged.GetUID() != "old-uid" || merged.GetResourceVersion() != "42" {
+		t.Errorf("expected the server fields of the live object, got uid=%q resourceVersion=%q", merged.GetUID(), merged.GetResourceVersion())
+	}
+	if merged.GetName() != "nginx-conf-new" {
+		t.Errorf("expected the local name, got %q", merged.GetName())
+	}
+	if data, _, _ := unstructured.NestedString(merged.Object, "data", "test"); data != "data" {
+		t.Errorf("expected the local data, got %q", data)
+	}
+	if merged.GetAnnotations() != nil {
+		t.Errorf("expected the 'last-applied-configuration' annotation to be removed, got %v", merged.GetAnnotations())
+	}
+	if local.GetUID() != "" {
+		t.Errorf("expected the local object not to be modified")
+	}
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/kubectl/pkg/cmd/diff"
+)
+
+// objectKey identifies an object regardless of its version.
+type objectKey struct {
+	groupKind schema.GroupKind
+	namespace string
+	name      string
+}
+
+// realnamedObject is a local object having the real name label.
+type realnamedObject struct {
+	info  *resource.Info
+	local *unstructured.Unstructured
+	name  string
+}
+
+// orphanTracker collects what the input uses while visiting it, to find the live
+// generations of the real names which are no longer used.
+type orphanTracker struct {
+	// replaceWorkloads indicates that the live workloads in the input will be
+	// replaced by the local ones, so that their references are not considered.
+	replaceWorkloads bool
+
+	mu        sync.Mutex
+	realnamed []realnamedObject
+	names     map[indexKey]map[string]bool
+	objects   map[objectKey]bool
+	refs      referenceIndex
+}
+
+func newOrphanTracker(replaceWorkloads bool) *orphanTracker {
+	return &orphanTracker{
+		replaceWorkloads: replaceWorkloads,
+		names:            map[indexKey]map[string]bool{},
+		objects:          map[objectKey]bool{},
+		refs:             referenceIndex{},
+	}
+}
+
+// orphan is a live generation of a real name which is no longer used.
+type orphan struct {
+	// info has no object yet.
+	info              *resource.Info
+	realname          string
+	uid               types.UID
+	creationTimestamp metav1.Time
+
+	// referencedBy holds the live workloads still referencing the generation.
+	referencedBy []string
+}
+
+// add records the local object of the info. It must be called before info.Object
+// is replaced with the live object.
+func (t *orphanTracker) add(info *resource.Info, local *unstructured.Unstructured) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	scope := scopeOf(info)
+	if t.names[scope] == nil {
+		t.names[scope] = map[string]bool{}
+	}
+	t.names[scope][local.GetName()] = true
+	t.objects[objectKey{groupKind: local.GroupVersionKind().GroupKind(), namespace: local.GetNamespace(), name: local.GetName()}] = true
+
+	if name := realName(local); len(name) > 0 {
+		t.realnamed = append(t.realnamed, realnamedObject{info: info, local: local, name: name})
+	}
+	return t.refs.add(local)
+}
+
+// find returns the live generations of the real names in the input which are used
+// neither by the input nor by live workloads. If replaceWorkloads is set, live
+// workloads in the input are not considered.
+func (t *orphanTracker) find(lookup *realnameLookup, client dynamic.Interface) ([]orphan, error) {
+	superseded, err := t.superseded(lookup, client)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []orphan
+	for _, o := range superseded {
+		if len(o.referencedBy) == 0 {
+			orphans = append(orphans, o)
+		}
+	}
+	return orphans, nil
+}
+
+// superseded returns the live generations of the real names in the input which are
+// not used by the input, with the live workloads still referencing them.
+func (t *orphanTracker) superseded(lookup *realnameLookup, client dynamic.Interface) ([]orphan, error) {
+	liveRefs := map[string]referenceIndex{}
+	inInput := func(obj *unstructured.Unstructured) bool {
+		return t.replaceWorkloads && t.objects[objectKey{groupKind: obj.GroupVersionKind().GroupKind(), namespace: obj.GetNamespace(), name: obj.GetName()}]
+	}
+
+	found := map[objectKey]bool{}
+	var orphans []orphan
+	for _, r := range t.realnamed {
+		candidates, err := lookup.candidates(r.info, r.local, r.name)
+		if err != nil {
+			return nil, err
+		}
+
+		scope := scopeOf(r.info)
+		gvk := r.info.Mapping.GroupVersionKind
+		for _, c := range candidates {
+			key := objectKey{groupKind: gvk.GroupKind(), namespace: scope.namespace, name: c.GetName()}
+			if t.names[scope][c.GetName()] || found[key] {
+				continue
+			}
+
+			var referencedBy []string
+			if isReferable(gvk) {
+				if len(t.refs.referrers(gvk.Kind, scope.namespace, c.GetName())) > 0 {
+					continue
+				}
+				refs, ok := liveRefs[scope.namespace]
+				if !ok {
+					refs = referenceIndex{}
+					if err := listWorkloadReferences(client, scope.namespace, refs, inInput); err != nil {
+						return nil, err
+					}
+					liveRefs[scope.namespace] = refs
+				}
+				referencedBy = refs.referrers(gvk.Kind, scope.namespace, c.GetName())
+			}
+
+			found[key] = true
+			orphans = append(orphans, orphan{
+				info: &resource.Info{
+					Client:    r.info.Client,
+					Mapping:   r.info.Mapping,
+					Namespace: scope.namespace,
+					Name:      c.GetName(),
+				},
+				realname:          r.name,
+				uid:               c.GetUID(),
+				creationTimestamp: c.GetCreationTimestamp(),
+				referencedBy:      referencedBy,
+			})
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return diff.InfoObject{Info: orphans[i].info}.Name() < diff.InfoObject{Info: orphans[j].info}.Name()
+	})
+	return orphans, nil
+}
+
+// deleteGeneration deletes the live generation unless it has been replaced by
+// another object with the same name.
+func deleteGeneration(o orphan) error {
+	uid := o.uid
+	_, err := resource.NewHelper(o.info.Client, o.info.Mapping).DeleteWithOptions(o.info.Namespace, o.info.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid},
+	})
+	if isNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// isReferable reports whether objects of the kind can be referenced by workloads.
+func isReferable(gvk schema.GroupVersionKind) bool {
+	return gvk.Group == "" && (gvk.Kind == "ConfigMap" || gvk.Kind == "Secret")
+}
+
+// printPruned prints the live object of the info only as the LIVE version, so that
+// the diff shows it as deleted.
+func printPruned(differ *diff.Differ, info *resource.Info, printer diff.Printer, showManagedFields bool) error {
+	return printDeleted(differ, diff.InfoObject{Info: info}.Name(), info.Object.(*unstructured.Unstructured), printer, showManagedFields)
+}
+
+// printDeleted prints the object only as the older version, so that the diff shows
+// it as deleted. The values of Secrets are masked as in the diff of the other objects.
+func printDeleted(differ *diff.Differ, name string, deleted *unstructured.Unstructured, printer diff.Printer, showManagedFields bool) error {
+	deleteLastApplied(deleted)
+	if !showManagedFields {
+		deleted.SetManagedFields(nil)
+	}
+
+	var obj runtime.Object = deleted
+	if gvk := deleted.GroupVersionKind(); gvk.Version == "v1" && gvk.Kind == "Secret" {
+		m, err := diff.NewMasker(deleted, deleted)
+		if err != nil {
+			return err
+		}
+		obj = m.From()
+	}
+	return differ.From.Print(name, obj, printer)
+}
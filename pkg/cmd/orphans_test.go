@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var configMapMapping = &meta.RESTMapping{
+	Resource:         schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+	GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+	Scope:            meta.RESTScopeNamespace,
+}
+
+// newIndexedLookup creates a realnameLookup whose index of the scope is already filled with the live objects
+func newIndexedLookup(scope indexKey, live ...metav1.PartialObjectMetadata) *realnameLookup {
+	idx := &realnameIndex{items: map[string][]metav1.PartialObjectMetadata{}}
+	idx.once.Do(func() {})
+	for _, item := range live {
+		name := item.GetLabels()[realNameLabel]
+		idx.items[name] = append(idx.items[name], item)
+	}
+
+	return &realnameLookup{
+		strategy: targetSelectionStrategyError,
+		indexes:  map[indexKey]*realnameIndex{scope: idx},
+	}
+}
+
+// newLiveMetadata creates the metadata of a live object with the real name label
+func newLiveMetadata(name, realname string) metav1.PartialObjectMetadata {
+	return metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{realNameLabel: realname},
+		},
+	}
+}
+
+// newDynamicClient creates a fake dynamic client serving the workload resources
+func newDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	listKinds := map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "pods"}:                        "PodList",
+		{Version: "v1", Resource: "replicationcontrollers"}:      "ReplicationControllerList",
+		{Group: "apps", Version: "v1", Resource: "deployments"}:  "DeploymentList",
+		{Group: "apps", Version: "v1", Resource: "replicasets"}:  "ReplicaSetList",
+		{Group: "apps", Version: "v1", Resource: "statefulsets"}: "StatefulSetList",
+		{Group: "apps", Version: "v1", Resource: "daemonsets"}:   "DaemonSetList",
+		{Group: "batch", Version: "v1", Resource: "jobs"}:        "JobList",
+		{Group: "batch", Version: "v1", Resource: "cronjobs"}:    "CronJobList",
+	}
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objects...)
+}
+
+// Test_orphanTracker_find tests finding the live generations no longer used after applying the input
+func Test_orphanTracker_find(t *testing.T) {
+	scope := indexKey{resource: configMapMapping.Resource, namespace: "default"}
+	lookup := newIndexedLookup(scope,
+		newLiveMetadata("nginx-conf-new", "nginx-conf"),
+		newLiveMetadata("nginx-conf-old1", "nginx-conf"),
+		newLiveMetadata("nginx-conf-old2", "nginx-conf"),
+		newLiveMetadata("other-conf-abc", "other-conf"),
+	)
+
+	// nginx-conf-old1 is referenced only by the live version of the Deployment in the input,
+	// and nginx-conf-old2 is referenced by a live Deployment outside of the input
+	client := newDynamicClient(
+		newWorkload("apps/v1", "Deployment", "nginx", newPodSpecWithConfigMapVolume("nginx-conf-old1")),
+		newWorkload("apps/v1", "Deployment", "legacy", newPodSpecWithConfigMapVolume("nginx-conf-old2")),
+	)
+
+	tracker := newOrphanTracker(true)
+	localConfigMap := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now())
+	localDeployment := newWorkload("apps/v1", "Deployment", "nginx", newPodSpecWithConfigMapVolume("nginx-conf-new"))
+	for _, local := range []*resource.Info{
+		{Mapping: configMapMapping, Namespace: "default", Name: localConfigMap.GetName(), Object: localConfigMap},
+		{
+			Mapping: &meta.RESTMapping{
+				Resource:         schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+				GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Scope:            meta.RESTScopeNamespace,
+			},
+			Namespace: "default",
+			Name:      localDeployment.GetName(),
+			Object:    localDeployment,
+		},
+	} {
+		if err := tracker.add(local, local.Object.(*unstructured.Unstructured)); err != nil {
+			t.Fatalf("add() returned error: %v", err)
+		}
+	}
+
+	orphans, err := tracker.find(lookup, client)
+	if err != nil {
+		t.Fatalf("find() returned error: %v", err)
+	}
+
+	if len(orphans) != 1 || orphans[0].info.Name != "nginx-conf-old1" {
+		var names []string
+		for _, o := range orphans {
+			names = append(names, o.info.Name)
+		}
+		t.Errorf("expected only nginx-conf-old1 to be orphaned, got %v", names)
+	}
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/kubectl/pkg/cmd/diff"
+)
+
+// plan records what was reviewed in a diff, so that it can be applied later only if
+// the live objects have not changed since then.
+type plan struct {
+	mu sync.Mutex
+
+	// ServerSide is whether the diff was made with --server-side, which the plan
+	// must be applied with.
+	ServerSide bool        `json:"serverSide"`
+	Objects    []planEntry `json:"objects"`
+}
+
+// planEntry is an object in a plan.
+type planEntry struct {
+	// Local is the object in the input, which is applied.
+	Local *unstructured.Unstructured `json:"local"`
+	// Merged is the object as it was shown in the diff. It is only recorded for
+	// reference, since it has the defaults and the fields of the other managers.
+	Merged *unstructured.Unstructured `json:"merged,omitempty"`
+	// LiveName and ResourceVersion identify the live object it was compared with.
+	// They are empty if there was no live object.
+	LiveName        string `json:"liveName,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// add records the local object with its merged and live versions. live is nil if
+// there is no live object.
+func (p *plan) add(local, merged, live runtime.Object) {
+	entry := planEntry{Local: local.(*unstructured.Unstructured)}
+	if merged != nil {
+		entry.Merged = merged.(*unstructured.Unstructured)
+	}
+	if live != nil {
+		entry.LiveName = live.(*unstructured.Unstructured).GetName()
+		entry.ResourceVersion = live.(*unstructured.Unstructured).GetResourceVersion()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Objects = append(p.Objects, entry)
+}
+
+// save writes the plan to the file. The file is only readable by the owner since
+// it may contain Secrets.
+func (p *plan) save(filename string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	data, err := json.MarshalIndent(p, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0600)
+}
+
+// loadPlan reads the plan saved with --save-plan.
+func loadPlan(filename string) (*plan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &plan{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to read the plan %s: %w", filename, err)
+	}
+	for i, entry := range p.Objects {
+		if entry.Local == nil {
+			return nil, fmt.Errorf("failed to read the plan %s: objects[%d] has no local object", filename, i)
+		}
+	}
+	return p, nil
+}
+
+// checkMode returns an error if the plan is applied in another mode than the diff
+// was made with, since the result would differ from what was shown.
+func (p *plan) checkMode(serverSide bool) error {
+	if p.ServerSide != serverSide {
+		return fmt.Errorf("the plan was created with --server-side=%t, it must be applied with --server-side=%t", p.ServerSide, p.ServerSide)
+	}
+	return nil
+}
+
+// renamed returns whether the object was compared with a live object of another
+// name, such as the previous generation of a real name.
+func (e planEntry) renamed() bool {
+	return len(e.LiveName) > 0 && e.LiveName != e.Local.GetName()
+}
+
+// verify returns an error if the live object compared in the plan has changed since
+// the plan was created. If there was no live object with the same name, the object
+// must still not exist.
+func (e planEntry) verify(info *resource.Info) error {
+	kind := strings.ToLower(info.Mapping.GroupVersionKind.Kind)
+	helper := resource.NewHelper(info.Client, info.Mapping)
+
+	if len(e.LiveName) == 0 || e.LiveName != info.Name {
+		_, err := helper.Get(info.Namespace, info.Name)
+		if err == nil {
+			return fmt.Errorf("%s/%s has been created since the plan was created", kind, info.Name)
+		}
+		if !isNotFound(err) {
+			return err
+		}
+		if len(e.LiveName) == 0 {
+			return nil
+		}
+	}
+
+	live, err := helper.Get(info.Namespace, e.LiveName)
+	if isNotFound(err) {
+		return fmt.Errorf("%s/%s has been deleted since the plan was created", kind, e.LiveName)
+	}
+	if err != nil {
+		return err
+	}
+	if rv := live.(*unstructured.Unstructured).GetResourceVersion(); rv != e.ResourceVersion {
+		return fmt.Errorf("%s/%s has changed since the plan was created: resourceVersion is %s, planned %s",
+			kind, e.LiveName, rv, e.ResourceVersion)
+	}
+	return nil
+}
+
+// recordingObject is a diff.Object which keeps the merged object computed for the
+// diff, so that it can be recorded in a plan.
+type recordingObject struct {
+	diff.Object
+
+	merged runtime.Object
+}
+
+func (obj *recordingObject) Merged() (runtime.Object, error) {
+	merged, err := obj.Object.Merged()
+	obj.merged = merged
+	return merged, err
+}
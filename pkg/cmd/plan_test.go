@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+	"k8s.io/client-go/rest/fake"
+	"k8s.io/kubectl/pkg/cmd/diff"
+)
+
+// Test_plan_save tests that a saved plan is loaded as it was
+func Test_plan_save(t *testing.T) {
+	created := time.Date(2021, 12, 23, 15, 0, 12, 0, time.UTC)
+	local := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", created)
+	merged := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", created)
+	merged.SetUID("merged-uid")
+	live := newConfigMapWithRealname("nginx-conf-old", "nginx-conf", created)
+	live.SetResourceVersion("42")
+
+	p := &plan{ServerSide: true}
+	p.add(local, merged, live)
+	p.add(local, local, nil)
+
+	filename := filepath.Join(t.TempDir(), "plan.json")
+	if err := p.save(filename); err != nil {
+		t.Fatalf("save() returned error: %v", err)
+	}
+	loaded, err := loadPlan(filename)
+	if err != nil {
+		t.Fatalf("loadPlan() returned error: %v", err)
+	}
+
+	if !loaded.ServerSide {
+		t.Errorf("expected the plan to be made with --server-side")
+	}
+	if len(loaded.Objects) != 2 {
+		t.Fatalf("expected 2 objects, got %d", len(loaded.Objects))
+	}
+	entry := loaded.Objects[0]
+	if !reflect.DeepEqual(entry.Local.Object, local.Object) {
+		t.Errorf("local = %v, want %v", entry.Local.Object, local.Object)
+	}
+	if entry.Merged.GetUID() != "merged-uid" {
+		t.Errorf("expected the merged object to be saved, got %v", entry.Merged.Object)
+	}
+	if entry.LiveName != "nginx-conf-old" || entry.ResourceVersion != "42" {
+		t.Errorf("live = (%s, %s), want (nginx-conf-old, 42)", entry.LiveName, entry.ResourceVersion)
+	}
+	if loaded.Objects[1].LiveName != "" || loaded.Objects[1].ResourceVersion != "" {
+		t.Errorf("expected no live object, got (%s, %s)", loaded.Objects[1].LiveName, loaded.Objects[1].ResourceVersion)
+	}
+}
+
+// Test_plan_checkMode tests refusing to apply a plan in another mode than the diff was made with
+func Test_plan_checkMode(t *testing.T) {
+	p := &plan{ServerSide: true}
+	if err := p.checkMode(true); err != nil {
+		t.Errorf("checkMode() returned error: %v", err)
+	}
+	if err := p.checkMode(false); err == nil || err.Error() != "the plan was created with --server-side=true, it must be applied with --server-side=true" {
+		t.Errorf("checkMode() error = %v", err)
+	}
+}
+
+// Test_planEntry_verify tests refusing to apply when the live object has changed since the plan was created
+func Test_planEntry_verify(t *testing.T) {
+	tests := []struct {
+		name          string
+		entry         planEntry
+		live          map[string]string
+		expectedError string
+	}{
+		{
+			name:  "unchanged",
+			entry: planEntry{LiveName: "nginx-conf-old", ResourceVersion: "42"},
+			live:  map[string]string{"nginx-conf-old": "42"},
+		},
+		{
+			name:          "changed",
+			entry:         planEntry{LiveName: "nginx-conf-old", ResourceVersion: "42"},
+			live:          map[string]string{"nginx-conf-old": "43"},
+			expectedError: "configmap/nginx-conf-old has changed since the plan was created: resourceVersion is 43, planned 42",
+		},
+		{
+			name:          "deleted",
+			entry:         planEntry{LiveName: "nginx-conf-old", ResourceVersion: "42"},
+			live:          map[string]string{},
+			expectedError: "configmap/nginx-conf-old has been deleted since the plan was created",
+		},
+		{
+			name:          "new generation created",
+			entry:         planEntry{LiveName: "nginx-conf-old", ResourceVersion: "42"},
+			live:          map[string]string{"nginx-conf-old": "42", "nginx-conf-new": "1"},
+			expectedError: "configmap/nginx-conf-new has been created since the plan was created",
+		},
+		{
+			name:  "still new",
+			entry: planEntry{},
+			live:  map[string]string{},
+		},
+		{
+			name:          "created",
+			entry:         planEntry{},
+			live:          map[string]string{"nginx-conf-new": "1"},
+			expectedError: "configmap/nginx-conf-new has been created since the plan was created",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fake.RESTClient{
+				NegotiatedSerializer: resource.UnstructuredPlusDefaultContentConfig().NegotiatedSerializer,
+				GroupVersion:         corev1.SchemeGroupVersion,
+				Client: fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+					header := http.Header{"Content-Type": []string{runtime.ContentTypeJSON}}
+					name := strings.TrimPrefix(req.URL.Path, "/namespaces/default/configmaps/")
+					rv, ok := tt.live[name]
+					if !ok {
+						body := `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`
+						return &http.Response{StatusCode: http.StatusNotFound, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+					}
+					body := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"` + name + `","namespace":"default","resourceVersion":"` + rv + `"}}`
+					return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(strings.NewReader(body))}, nil
+				}),
+			}
+			info := &resource.Info{Client: client, Mapping: configMapMapping, Namespace: "default", Name: "nginx-conf-new"}
+
+			err := tt.entry.verify(info)
+			if len(tt.expectedError) == 0 {
+				if err != nil {
+					t.Errorf("verify() returned error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("verify() error = %v, want %q", err, tt.expectedError)
+			}
+		})
+	}
+}
+
+// Test_recordingObject tests that the merged object computed for the diff is kept
+func Test_recordingObject(t *testing.T) {
+	local := newConfigMapWithRealname("nginx-conf-new", "nginx-conf", time.Now())
+	obj := &recordingObject{Object: RealnameDiffInfoObject{
+		infoObj: diff.InfoObject{
+			LocalObj: local,
+			Info:     &resource.Info{Mapping: configMapMapping, Namespace: "default", Name: local.GetName()},
+		},
+		notInstalled: true,
+	}}
+
+	merged, err := obj.Merged()
+	if err != nil {
+		t.Fatalf("Merged() returned error: %v", err)
+	}
+	if obj.merged != merged || obj.merged.(*unstructured.Unstructured) != local {
+		t.Errorf("expected the merged object to be recorded")
+	}
+}
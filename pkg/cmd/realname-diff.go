@@ -1,18 +1,25 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/openapi3"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 	"k8s.io/kubectl/pkg/cmd/apply"
 	"k8s.io/kubectl/pkg/cmd/diff"
@@ -31,7 +38,14 @@ var (
 
 Normally, "kubectl realname-diff" works the same as "kubectl diff", but if you
 set "real name" as a label, local and live resources with the same label will be
-compared.`
+compared.
+
+Live resources are looked up by real name in the namespace of the local resource,
+which defaults to the one given by --namespace. If --namespace is given explicitly,
+local resources in other namespaces are rejected. Cluster-scoped resources are
+looked up across the cluster. When --selector is given, live resources must also
+match it to be compared, including the one named the real name, which is compared
+if no live resource has the real name label.`
 
 	diffExample = `  # Make sure you have already labeled the resources with
   # "realname-diff/realname: [real name]". For a complete example, see:
@@ -64,12 +78,16 @@ func NewCmdRealnameDiff(streams genericclioptions.IOStreams) *cobra.Command {
 	factory := cmdutil.NewFactory(configFlags)
 
 	cmd := &cobra.Command{
-		Use:                   "kubectl realname-diff -f FILENAME",
+		Use:                   "realname-diff -f FILENAME",
 		DisableFlagsInUseLine: true,
 		Short:                 "Diff live and local resources ignoring Kustomize hash-suffixes.",
 		Long:                  diffLong,
 		Example:               diffExample,
 		Version:               version.Version,
+		Annotations: map[string]string{
+			// Shows the subcommands as "kubectl realname-diff [command]".
+			cobra.CommandDisplayNameAnnotation: "kubectl realname-diff",
+		},
 		Run: func(cmd *cobra.Command, args []string) {
 			cmdutil.CheckDiffErr(options.Complete(factory, cmd))
 			cmdutil.CheckDiffErr(validateArgs(cmd, args))
@@ -82,6 +100,16 @@ func NewCmdRealnameDiff(streams genericclioptions.IOStreams) *cobra.Command {
 			}
 		},
 	}
+	cmd.CompletionOptions.DisableDefaultCmd = true
+	cmd.AddCommand(NewCmdApply(streams))
+	cmd.AddCommand(NewCmdGC(streams))
+	cmd.AddCommand(NewCmdHistory(streams))
+	cmd.AddCommand(NewCmdGenerations(streams))
+	cmd.AddCommand(NewCmdSnapshot(streams))
+	cmd.AddCommand(NewCmdLocal(streams))
+	cmd.AddCommand(NewCmdDrift(streams))
+	cmd.AddCommand(NewCmdVerify(streams))
+	cmd.AddCommand(NewCmdLint(streams))
 	cmd.SetVersionTemplate("Real Name Diff Version: {{.Version}}\n")
 	cmd.Flags().BoolP("version", "v", false, "Version for kubectl-realname-diff")
 
@@ -94,6 +122,17 @@ func NewCmdRealnameDiff(streams genericclioptions.IOStreams) *cobra.Command {
 	cmdutil.AddFieldManagerFlagVar(cmd, &options.fieldManager, apply.FieldManagerClientSideApply)
 
 	cmd.Flags().StringVar(&options.targetSelectionStrategy, "target-selection-strategy", targetSelectionStrategyError, "Specifies the behavior when multiple diff targets are found. The value must be either \"error\" or \"latest\". In \"latest\", the selection is based on \"metadata.creationTimestamp\"")
+	cmd.Flags().BoolVar(&options.allCandidates, "include-all-candidates", options.allCandidates, "If true, live objects being deleted or controlled by another object are also considered as the comparison target when looking up by real name.")
+	cmd.Flags().BoolVar(&options.showOrphans, "show-orphans", options.showOrphans, "If true, also show the live objects having the real names in the input which are no longer used by the input nor by live workloads as deleted.")
+	cmd.Flags().BoolVar(&options.verbose, "verbose", options.verbose, "If true, report the details of the real name lookups to stderr.")
+	cmd.Flags().StringSliceVar(&options.matchLabels, "match-labels", options.matchLabels, "Label keys whose values must also match between the local and live objects when looking up by real name. (e.g. --match-labels app.kubernetes.io/instance)")
+	cmd.Flags().StringVar(&options.liveFrom, "live-from", options.liveFrom, "If set, diff against the objects in the files under the directory instead of the cluster, without any API calls. Server-side defaulting is not applied to the merged objects.")
+	cmd.Flags().StringVar(&options.compareContext, "compare-context", options.compareContext, "If set, diff the live objects in the current context with the live objects in this context of the same kubeconfig, instead of with the input. The fields specific to each cluster, such as uid and status, are ignored.")
+	cmd.Flags().BoolVar(&options.threeWay, "three-way", options.threeWay, "If true, also show the changes from the last applied configurations to the live objects, made out of band, before the changes from the live objects to the merged objects. Only the fields in the last applied configurations are compared.")
+	cmd.Flags().StringSliceVar(&options.contexts, "contexts", options.contexts, "If set, run the diff against the cluster of each of these contexts in the kubeconfig concurrently, and report the identical diffs together with the exit status of each. Supports the shell file name patterns. (e.g. --contexts 'prod-*,staging')")
+	cmd.Flags().BoolVar(&options.allowDuplicateRealnames, "allow-duplicate-realnames", options.allowDuplicateRealnames, "If true, warn about objects of the same kind in a namespace sharing a real name in the input, instead of failing before looking up the live objects.")
+	cmd.Flags().BoolVar(&options.checkReferences, "check-references", options.checkReferences, "If true, warn about the ConfigMaps and Secrets referenced by the workloads in the input, except the optional ones, which are neither in the input nor live, so that the references will point at nothing after applying.")
+	cmd.Flags().StringVar(&options.savePlan, "save-plan", options.savePlan, "If set, save the plan to the file, which can be applied later by \"kubectl realname-diff apply --plan\". The plan contains Secrets as is.")
 
 	return cmd
 }
@@ -130,9 +169,34 @@ type RealnameDiffOptions struct {
 	cmdNamespace     string
 	enforceNamespace bool
 	builder          *resource.Builder
+	mapper           *pendingKindMapper
 	diffProgram      *diff.DiffProgram
 
 	targetSelectionStrategy string
+	matchLabels             []string
+	allCandidates           bool
+	showOrphans             bool
+	verbose                 bool
+	savePlan                string
+	liveFrom                string
+	threeWay                bool
+
+	allowDuplicateRealnames bool
+	checkReferences         bool
+
+	// live holds the objects read from --live-from.
+	live *liveSnapshot
+
+	compareContext string
+	otherFactory   cmdutil.Factory
+	otherMapper    meta.RESTMapper
+
+	contexts  []string
+	fanout    []*contextDiff
+	stdinFile string
+
+	// capture holds the diff instead of running the diff program if it is not nil.
+	capture *capturedDiff
 }
 
 func NewRealnameDiffOptions(streams genericclioptions.IOStreams) *RealnameDiffOptions {
@@ -148,13 +212,21 @@ func NewRealnameDiffOptions(streams genericclioptions.IOStreams) *RealnameDiffOp
 // It has all the information from the diff.InfoObject and whether the object has a real name label.
 type RealnameDiffInfoObject struct {
 	infoObj diff.InfoObject
+
+	// notInstalled indicates that the kind of the object is not installed in the
+	// cluster yet, but is defined by a CustomResourceDefinition in the input.
+	notInstalled bool
+
+	// offline indicates that the live object is read from a directory, so that the
+	// server cannot compute the merged object.
+	offline bool
 }
 
 var _ diff.Object = &RealnameDiffInfoObject{}
 
 // Live Returns the live version of the object
 func (obj RealnameDiffInfoObject) Live() runtime.Object {
-	if !obj.nameChanged() {
+	if !obj.nameChanged() && !obj.offline {
 		return obj.infoObj.Live()
 	}
 
@@ -163,16 +235,41 @@ func (obj RealnameDiffInfoObject) Live() runtime.Object {
 	// for it.
 	// To follow this original behavior and to prevent the exposure of Secret resources
 	// through this annotation, it should be deleted.
+	if obj.infoObj.Live() == nil {
+		return nil
+	}
 	unstructured := obj.infoObj.Live().(*unstructured.Unstructured)
-	annotations := unstructured.GetAnnotations()
-	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
-	unstructured.SetAnnotations(annotations)
+	deleteLastApplied(unstructured)
 
 	return unstructured
 }
 
+// deleteLastApplied deletes the 'last-applied-configuration' annotation from the object.
+func deleteLastApplied(obj *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	delete(annotations, lastAppliedAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+}
+
 // Merged returns the "merged" object, as it would look like if applied or created.
 func (obj RealnameDiffInfoObject) Merged() (runtime.Object, error) {
+	// The server cannot handle the object until the kind is installed, so the local
+	// object is used as is.
+	if obj.notInstalled {
+		return obj.infoObj.LocalObj, nil
+	}
+
+	if obj.offline {
+		var live *unstructured.Unstructured
+		if obj.infoObj.Live() != nil {
+			live = obj.infoObj.Live().(*unstructured.Unstructured)
+		}
+		return offlineMerged(obj.infoObj.LocalObj.(*unstructured.Unstructured), live), nil
+	}
+
 	if !obj.nameChanged() {
 		return obj.infoObj.Merged()
 	}
@@ -218,59 +315,6 @@ func realName(obj runtime.Object) string {
 	return ""
 }
 
-// getWithRealName retrieves the object from the `realname-diff/realname` label.
-// If the object is not found, it will try to retrieve it from the `metadata.name`.
-func getWithRealName(info *resource.Info, name string, strategy string) error {
-	gvk := info.Object.GetObjectKind().GroupVersionKind()
-	res, err := resource.NewHelper(info.Client, info.Mapping).List(info.Namespace, info.ResourceVersion, &metav1.ListOptions{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       gvk.Kind,
-			APIVersion: gvk.GroupVersion().String(),
-		},
-		LabelSelector: realNameLabel + "=" + name,
-	})
-	if err != nil {
-		return err
-	}
-
-	list := res.(*unstructured.UnstructuredList)
-	var target *unstructured.Unstructured
-
-	len := len(list.Items)
-	switch {
-	case len > 1:
-		switch strategy {
-		case targetSelectionStrategyError:
-			return fmt.Errorf("multiple objects have same realname label: realname=%s", name)
-
-		case targetSelectionStrategyLatest:
-			// Initialize to first item, then find the one with latest timestamp
-			latest := list.Items[0]
-			for i := 1; i < len; i++ {
-				if list.Items[i].GetCreationTimestamp().After(latest.GetCreationTimestamp().Time) {
-					latest = list.Items[i]
-				}
-			}
-			target = &latest
-		}
-
-	case len == 1:
-		target = &list.Items[0]
-
-	case len == 0:
-		obj, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, name)
-		if err != nil {
-			return err
-		}
-		target = obj.(*unstructured.Unstructured)
-	}
-
-	info.Object = target.DeepCopyObject()
-	info.ResourceVersion = target.GetResourceVersion()
-
-	return nil
-}
-
 func isNotFound(err error) bool {
 	return err != nil && errors.IsNotFound(err)
 }
@@ -279,6 +323,22 @@ func isConflict(err error) bool {
 	return err != nil && errors.IsConflict(err)
 }
 
+// visitInfos calls fn with each of the infos, running up to concurrency calls in
+// parallel. The infos not visited yet are skipped once a call fails.
+func visitInfos(infos []*resource.Info, concurrency int, fn func(info *resource.Info) error) error {
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(max(concurrency, 1))
+	for _, info := range infos {
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fn(info)
+		})
+	}
+	return g.Wait()
+}
+
 func (o *RealnameDiffOptions) Complete(factory cmdutil.Factory, cmd *cobra.Command) error {
 	var err error
 
@@ -287,6 +347,43 @@ func (o *RealnameDiffOptions) Complete(factory cmdutil.Factory, cmd *cobra.Comma
 		return err
 	}
 
+	if _, ok := targetSelectionStrategies[o.targetSelectionStrategy]; !ok {
+		return fmt.Errorf("--target-selection-strategy must be either \"error\" or \"latest\"")
+	}
+
+	if len(o.contexts) > 0 {
+		config, err := factory.ToRawKubeConfigLoader().RawConfig()
+		if err != nil {
+			return err
+		}
+		return o.completeContexts(config.Contexts, cmd)
+	}
+
+	if len(o.liveFrom) > 0 {
+		return o.completeOffline(factory, cmd)
+	}
+
+	if len(o.compareContext) > 0 {
+		if o.showOrphans {
+			return fmt.Errorf("--show-orphans cannot be used with --compare-context")
+		}
+		if len(o.savePlan) > 0 {
+			return fmt.Errorf("--save-plan cannot be used with --compare-context")
+		}
+		if o.threeWay {
+			return fmt.Errorf("--three-way cannot be used with --compare-context")
+		}
+		if o.checkReferences {
+			return fmt.Errorf("--check-references cannot be used with --compare-context")
+		}
+
+		o.otherFactory = newContextFactory(cmd, o.compareContext)
+		o.otherMapper, err = o.otherFactory.ToRESTMapper()
+		if err != nil {
+			return err
+		}
+	}
+
 	o.serverSideApply = cmdutil.GetServerSideApplyFlag(cmd)
 	o.fieldManager = apply.GetApplyFieldManagerFlag(cmd, o.serverSideApply)
 	o.forceConflicts = cmdutil.GetForceConflictsFlag(cmd)
@@ -316,16 +413,52 @@ func (o *RealnameDiffOptions) Complete(factory cmdutil.Factory, cmd *cobra.Comma
 		return err
 	}
 
-	o.builder = factory.NewBuilder()
+	o.builder, o.mapper, err = newPendingKindBuilder(factory)
+	return err
+}
+
+// completeOffline completes the options for --live-from, which need no cluster.
+func (o *RealnameDiffOptions) completeOffline(factory cmdutil.Factory, cmd *cobra.Command) error {
+	var err error
 
-	if _, ok := targetSelectionStrategies[o.targetSelectionStrategy]; !ok {
-		return fmt.Errorf("--target-selection-strategy must be either \"error\" or \"latest\"")
+	if cmdutil.GetServerSideApplyFlag(cmd) {
+		return fmt.Errorf("--server-side cannot be used with --live-from")
+	}
+	if o.showOrphans {
+		return fmt.Errorf("--show-orphans cannot be used with --live-from")
+	}
+	if len(o.savePlan) > 0 {
+		return fmt.Errorf("--save-plan cannot be used with --live-from")
+	}
+	if len(o.compareContext) > 0 {
+		return fmt.Errorf("--compare-context cannot be used with --live-from")
 	}
 
+	o.cmdNamespace, o.enforceNamespace, err = factory.ToRawKubeConfigLoader().Namespace()
+	if clientcmd.IsEmptyConfig(err) {
+		o.cmdNamespace, err = metav1.NamespaceDefault, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	o.live, err = loadLiveSnapshot(o.liveFrom)
+	if err != nil {
+		return err
+	}
+
+	o.builder = resource.NewLocalBuilder()
 	return nil
 }
 
 func (o *RealnameDiffOptions) Run() error {
+	if len(o.contexts) > 0 {
+		return o.runContexts()
+	}
+	if len(o.compareContext) > 0 {
+		return o.runCompareContext()
+	}
+
 	differ, err := diff.NewDiffer("LIVE", "MERGED")
 	if err != nil {
 		return err
@@ -333,6 +466,23 @@ func (o *RealnameDiffOptions) Run() error {
 	defer differ.TearDown()
 
 	printer := diff.Printer{}
+	lookup := &realnameLookup{
+		strategy:      o.targetSelectionStrategy,
+		matchLabels:   o.matchLabels,
+		allCandidates: o.allCandidates,
+		selector:      o.selector,
+	}
+	if o.verbose {
+		lookup.verboseOut = o.diffProgram.ErrOut
+	}
+	if o.live != nil {
+		lookup.live = o.live
+		fmt.Fprintf(
+			o.diffProgram.ErrOut,
+			"Diffing against the objects in %s without a cluster, server-side defaulting is not applied to the merged objects\n",
+			o.liveFrom,
+		)
+	}
 
 	r := o.builder.
 		Unstructured().
@@ -346,24 +496,113 @@ func (o *RealnameDiffOptions) Run() error {
 		return err
 	}
 
-	err = r.Visit(func(info *resource.Info, err error) error {
+	// The input is read at once to find the duplicate real names before looking up
+	// any live objects.
+	infos, err := r.Infos()
+	if err != nil {
+		return err
+	}
+	if o.live != nil {
+		o.live.addInputCRDs(infos)
+		for _, info := range infos {
+			o.live.resolve(info, o.cmdNamespace)
+		}
+	}
+	if err := checkDuplicateRealnames(infos, o.allowDuplicateRealnames, o.diffProgram.ErrOut); err != nil {
+		return err
+	}
+
+	// Custom resources whose kinds are not installed yet are diffed after all the
+	// CustomResourceDefinitions in the input are known.
+	var mu sync.Mutex
+	crds := map[schema.GroupKind]crdKind{}
+	var notInstalled []*resource.Info
+
+	var orphans *orphanTracker
+	if o.showOrphans {
+		orphans = newOrphanTracker(true)
+	}
+
+	var savedPlan *plan
+	if len(o.savePlan) > 0 {
+		savedPlan = &plan{ServerSide: o.serverSideApply}
+	}
+
+	var references *referenceChecker
+	if o.checkReferences {
+		references = newReferenceChecker()
+	}
+
+	var drift *driftDiffer
+	if o.threeWay {
+		drift, err = newDriftDiffer()
 		if err != nil {
 			return err
 		}
+		defer drift.tearDown()
+	}
+
+	err = visitInfos(infos, o.concurrency, func(info *resource.Info) error {
+		if gk, kind, ok := crdKindOf(info.Object.(*unstructured.Unstructured)); ok {
+			mu.Lock()
+			crds[gk] = kind
+			mu.Unlock()
+		}
+		if o.mapper != nil && o.mapper.pendingErr(info.Mapping.GroupVersionKind.GroupKind()) != nil {
+			mu.Lock()
+			notInstalled = append(notInstalled, info)
+			mu.Unlock()
+			return nil
+		}
 
 		local := info.Object.DeepCopyObject()
+		if err := warnHashSuffix(o.diffProgram.ErrOut, local.(*unstructured.Unstructured), "local"); err != nil {
+			return err
+		}
+		if orphans != nil {
+			if err := orphans.add(info, local.(*unstructured.Unstructured)); err != nil {
+				return err
+			}
+		}
+		if references != nil {
+			if err := references.add(local.(*unstructured.Unstructured)); err != nil {
+				return err
+			}
+		}
 
 		for i := 1; i <= maxRetries; i++ {
 			if on := realName(local); len(on) > 0 {
-				err = getWithRealName(info, on, o.targetSelectionStrategy)
+				err = lookup.getWithRealName(info, local.(*unstructured.Unstructured), on)
 			} else {
-				err = info.Get()
+				err = lookup.get(info, info.Name)
 			}
 			if isNotFound(err) {
 				info.Object = nil
 			} else if err != nil {
 				return err
 			}
+			if i == 1 && info.Object != nil {
+				if err := warnHashSuffix(o.diffProgram.ErrOut, info.Object.(*unstructured.Unstructured), "live"); err != nil {
+					return err
+				}
+			}
+
+			// The drift is recorded before diffing, since the live object loses the
+			// 'last-applied-configuration' annotation in the diff of renamed objects.
+			if drift != nil && info.Object != nil {
+				ok, err := drift.add(diff.InfoObject{Info: info}.Name(), info.Object.(*unstructured.Unstructured), printer)
+				if err != nil {
+					return err
+				}
+				if !ok && i == 1 {
+					fmt.Fprintf(
+						o.diffProgram.ErrOut,
+						"Object (%v: %v) has no last applied configuration, no drift is shown\n",
+						info.Mapping.GroupVersionKind,
+						info.Name,
+					)
+				}
+			}
 
 			force := i == maxRetries
 			if force {
@@ -387,12 +626,18 @@ func (o *RealnameDiffOptions) Run() error {
 					ForceConflicts:  o.forceConflicts,
 					IOStreams:       o.diffProgram.IOStreams,
 				},
+				offline: o.live != nil,
 			}
 
-			err = differ.Diff(obj, printer, o.showManagedFields)
+			recorded := &recordingObject{Object: obj}
+			err = differ.Diff(recorded, printer, o.showManagedFields)
+			if err == nil && savedPlan != nil {
+				savedPlan.add(local, recorded.merged, info.Object)
+			}
 			if !isConflict(err) {
 				break
 			}
+			lookup.invalidate(info)
 		}
 
 		apply.WarnIfDeleting(info.Object, o.diffProgram.ErrOut)
@@ -404,5 +649,98 @@ func (o *RealnameDiffOptions) Run() error {
 		return err
 	}
 
+	for _, info := range notInstalled {
+		gk := info.Mapping.GroupVersionKind.GroupKind()
+		if err := resolveNotInstalled(info, crds, o.mapper.pendingErr(gk)); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(
+			o.diffProgram.ErrOut,
+			"Object (%v: %v) is of a kind defined in the input but not installed yet, diffing as a new object without server-side defaulting\n",
+			info.Mapping.GroupVersionKind,
+			info.Name,
+		)
+
+		local := info.Object
+		info.Object = nil
+		obj := RealnameDiffInfoObject{
+			infoObj: diff.InfoObject{
+				LocalObj: local,
+				Info:     info,
+				Encoder:  scheme.DefaultJSONEncoder(),
+			},
+			notInstalled: true,
+		}
+		if err := differ.Diff(obj, printer, o.showManagedFields); err != nil {
+			return err
+		}
+		if savedPlan != nil {
+			savedPlan.add(local, local, nil)
+		}
+	}
+
+	if references != nil {
+		for _, d := range references.dangling(o.liveObjectExists) {
+			if d.err != nil {
+				fmt.Fprintf(
+					o.diffProgram.ErrOut,
+					"Warning: %s %s in namespace %q referenced by %s could not be checked: %v\n",
+					d.ref.kind,
+					d.ref.name,
+					d.ref.namespace,
+					strings.Join(d.referrers, ", "),
+					d.err,
+				)
+				continue
+			}
+			fmt.Fprintf(
+				o.diffProgram.ErrOut,
+				"Warning: %s %s in namespace %q referenced by %s is neither in the input nor live\n",
+				d.ref.kind,
+				d.ref.name,
+				d.ref.namespace,
+				strings.Join(d.referrers, ", "),
+			)
+		}
+	}
+
+	if orphans != nil {
+		found, err := orphans.find(lookup, o.dynamicClient)
+		if err != nil {
+			return err
+		}
+		for _, orphan := range found {
+			info := orphan.info
+			if err := info.Get(); isNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(
+				o.diffProgram.ErrOut,
+				"Object (%v: %v) would be pruned\n",
+				info.Mapping.GroupVersionKind,
+				info.Name,
+			)
+			if err := printPruned(differ, info, printer, o.showManagedFields); err != nil {
+				return err
+			}
+		}
+	}
+
+	if savedPlan != nil {
+		if err := savedPlan.save(o.savePlan); err != nil {
+			return err
+		}
+	}
+
+	if o.capture != nil {
+		return o.capture.run(differ)
+	}
+	if drift != nil {
+		return o.runThreeWay(drift, differ)
+	}
 	return differ.Run(o.diffProgram)
 }
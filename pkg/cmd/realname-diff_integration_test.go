@@ -4,22 +4,31 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/cli-runtime/pkg/resource"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/kubectl/pkg/cmd/diff"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 )
@@ -173,6 +182,38 @@ func createSecretWithRealname(t *testing.T, namespace, name, realname string) *u
 func createResourceInfo(t *testing.T, namespace string, gvk schema.GroupVersionKind) *resource.Info {
 	t.Helper()
 
+	return createResourceInfoWithConfig(t, rest.CopyConfig(cfg), namespace, gvk)
+}
+
+// roundTripCounter counts the list requests sent to the API server
+type roundTripCounter struct {
+	rt    http.RoundTripper
+	lists atomic.Int32
+}
+
+func (c *roundTripCounter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Has("labelSelector") {
+		c.lists.Add(1)
+	}
+	return c.rt.RoundTrip(req)
+}
+
+// createCountingResourceInfo creates a resource.Info object whose list requests are counted by the counter
+func createCountingResourceInfo(t *testing.T, counter *roundTripCounter, namespace string, gvk schema.GroupVersionKind) *resource.Info {
+	t.Helper()
+
+	restConfig := rest.CopyConfig(cfg)
+	restConfig.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		counter.rt = rt
+		return counter
+	}
+	return createResourceInfoWithConfig(t, restConfig, namespace, gvk)
+}
+
+// createResourceInfoWithConfig creates a resource.Info object whose client is built from the rest config
+func createResourceInfoWithConfig(t *testing.T, restConfig *rest.Config, namespace string, gvk schema.GroupVersionKind) *resource.Info {
+	t.Helper()
+
 	// Get REST mapper from k8sClient
 	mapper := k8sClient.RESTMapper()
 
@@ -183,7 +224,6 @@ func createResourceInfo(t *testing.T, namespace string, gvk schema.GroupVersionK
 
 	// Create a REST client configured for unstructured objects
 	// Use UnstructuredJSONScheme to ensure responses are decoded as unstructured
-	restConfig := rest.CopyConfig(cfg)
 	gv := mapping.GroupVersionKind.GroupVersion()
 	restConfig.GroupVersion = &gv
 	restConfig.APIPath = "/api"
@@ -251,7 +291,7 @@ func TestGetWithRealName_SingleMatch(t *testing.T) {
 
 	// Create Info and call getWithRealName
 	info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
-	err := getWithRealName(info, "my-config", targetSelectionStrategyError)
+	err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config")
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -297,7 +337,7 @@ func TestGetWithRealName_MultipleMatches(t *testing.T) {
 			time.Sleep(10 * time.Millisecond) // Allow final resource to be fully persisted
 
 			info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
-			err := getWithRealName(info, "my-config", tt.strategy)
+			err := (&realnameLookup{strategy: tt.strategy}).getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config")
 
 			if tt.expectError {
 				if err == nil {
@@ -336,7 +376,7 @@ func TestGetWithRealName_Fallback(t *testing.T) {
 
 	// getWithRealName should fallback to Get() by name
 	info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
-	err := getWithRealName(info, "my-config", targetSelectionStrategyError)
+	err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config")
 
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -358,7 +398,7 @@ func TestGetWithRealName_NotFound(t *testing.T) {
 
 	// Don't create any resources
 	info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
-	err := getWithRealName(info, "nonexistent", targetSelectionStrategyError)
+	err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), "nonexistent")
 
 	if !errors.IsNotFound(err) {
 		t.Errorf("expected NotFound error, got: %v", err)
@@ -375,7 +415,7 @@ func TestGetWithRealName_NamespaceIsolation(t *testing.T) {
 
 	// Search in ns2 should not find it
 	info := createResourceInfo(t, ns2, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
-	err := getWithRealName(info, "my-config", targetSelectionStrategyError)
+	err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config")
 
 	if !errors.IsNotFound(err) {
 		t.Errorf("expected NotFound (namespace isolation), got: %v", err)
@@ -390,7 +430,7 @@ func TestGetWithRealName_DeepCopy(t *testing.T) {
 
 	// First retrieval
 	info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
-	err := getWithRealName(info, "my-config", targetSelectionStrategyError)
+	err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -407,7 +447,7 @@ func TestGetWithRealName_DeepCopy(t *testing.T) {
 
 	// Second retrieval should get unmodified object
 	info2 := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
-	err = getWithRealName(info2, "my-config", targetSelectionStrategyError)
+	err = (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info2, info2.Object.(*unstructured.Unstructured), "my-config")
 	if err != nil {
 		t.Fatalf("unexpected error on re-fetch: %v", err)
 	}
@@ -426,3 +466,341 @@ func TestGetWithRealName_DeepCopy(t *testing.T) {
 		t.Error("expected realname label to be preserved")
 	}
 }
+
+// TestGetWithRealName_MatchLabels tests that match labels isolate candidates of different applications
+func TestGetWithRealName_MatchLabels(t *testing.T) {
+	namespace := setupTestNamespace(t)
+
+	for name, instance := range map[string]string{"app-config-abc": "frontend", "app-config-def": "backend"} {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					realNameLabel:                "app-config",
+					"app.kubernetes.io/instance": instance,
+				},
+			},
+		}
+		if err := k8sClient.Create(context.Background(), cm); err != nil {
+			t.Fatalf("failed to create ConfigMap: %v", err)
+		}
+	}
+
+	// Without match labels, both applications' objects are candidates
+	info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), "app-config")
+	if err == nil {
+		t.Fatal("expected error without match labels, got nil")
+	}
+
+	// With match labels, only the object of the same instance is a candidate
+	info = createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	info.Object.(*unstructured.Unstructured).SetLabels(map[string]string{
+		realNameLabel:                "app-config",
+		"app.kubernetes.io/instance": "backend",
+	})
+	lookup := &realnameLookup{
+		strategy:    targetSelectionStrategyError,
+		matchLabels: []string{"app.kubernetes.io/instance"},
+	}
+	if err := lookup.getWithRealName(info, info.Object.(*unstructured.Unstructured), "app-config"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertResourceMatches(t, info, "app-config-def", "app-config")
+}
+
+// TestGetWithRealName_ExcludedCandidates tests that terminating and controller-owned objects are not selected
+func TestGetWithRealName_ExcludedCandidates(t *testing.T) {
+	namespace := setupTestNamespace(t)
+	ctx := context.Background()
+
+	createConfigMapWithRealname(t, namespace, "my-config-abc", "my-config", time.Time{})
+
+	// A terminating object, kept alive by a finalizer
+	terminating := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "my-config-def",
+			Namespace:  namespace,
+			Labels:     map[string]string{realNameLabel: "my-config"},
+			Finalizers: []string{"example.com/test"},
+		},
+	}
+	if err := k8sClient.Create(ctx, terminating); err != nil {
+		t.Fatalf("failed to create ConfigMap: %v", err)
+	}
+	t.Cleanup(func() {
+		patch := client.RawPatch(types.MergePatchType, []byte(`{"metadata":{"finalizers":null}}`))
+		if err := k8sClient.Patch(ctx, terminating, patch); err != nil && !errors.IsNotFound(err) {
+			t.Logf("warning: failed to remove finalizer: %v", err)
+		}
+	})
+	if err := k8sClient.Delete(ctx, terminating); err != nil {
+		t.Fatalf("failed to delete ConfigMap: %v", err)
+	}
+
+	// An object controlled by another object
+	controller := true
+	owned := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-config-ghi",
+			Namespace: namespace,
+			Labels:    map[string]string{realNameLabel: "my-config"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "example.com/v1",
+				Kind:       "Release",
+				Name:       "my-release",
+				UID:        types.UID("0d69cf40-d201-47fe-bad2-8c3333ef0d07"),
+				Controller: &controller,
+			}},
+		},
+	}
+	if err := k8sClient.Create(ctx, owned); err != nil {
+		t.Fatalf("failed to create ConfigMap: %v", err)
+	}
+
+	var out bytes.Buffer
+	lookup := &realnameLookup{strategy: targetSelectionStrategyError, verboseOut: &out}
+	info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	if err := lookup.getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertResourceMatches(t, info, "my-config-abc", "my-config")
+
+	for _, name := range []string{"my-config-def", "my-config-ghi"} {
+		if !bytes.Contains(out.Bytes(), []byte(name)) {
+			t.Errorf("expected excluded candidate %q to be reported, got %q", name, out.String())
+		}
+	}
+
+	// All three objects are candidates when they are included
+	lookup = &realnameLookup{strategy: targetSelectionStrategyError, allCandidates: true}
+	info = createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	if err := lookup.getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config"); err == nil {
+		t.Fatal("expected error when all candidates are included, got nil")
+	}
+}
+
+// TestGetWithRealName_ListOncePerScope tests that live objects are listed once per resource and namespace
+func TestGetWithRealName_ListOncePerScope(t *testing.T) {
+	namespace := setupTestNamespace(t)
+
+	realnames := []string{"config-a", "config-b", "config-c"}
+	for _, realname := range realnames {
+		createConfigMapWithRealname(t, namespace, realname+"-abc123", realname, time.Time{})
+	}
+
+	counter := &roundTripCounter{}
+	lookup := &realnameLookup{strategy: targetSelectionStrategyError}
+	for _, realname := range realnames {
+		info := createCountingResourceInfo(t, counter, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		if err := lookup.getWithRealName(info, info.Object.(*unstructured.Unstructured), realname); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertResourceMatches(t, info, realname+"-abc123", realname)
+	}
+
+	if n := counter.lists.Load(); n != 1 {
+		t.Errorf("expected 1 list request to the API server, got %d", n)
+	}
+
+	// Invalidating the scope makes the next lookup list the objects again
+	info := createCountingResourceInfo(t, counter, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	lookup.invalidate(info)
+	if err := lookup.getWithRealName(info, info.Object.(*unstructured.Unstructured), "config-a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := counter.lists.Load(); n != 2 {
+		t.Errorf("expected 2 list requests to the API server after invalidation, got %d", n)
+	}
+}
+
+// TestGetWithRealName_Paginated tests that candidates spanning multiple list pages are all considered
+func TestGetWithRealName_Paginated(t *testing.T) {
+	namespace := setupTestNamespace(t)
+
+	defer func(size int64) { listPageSize = size }(listPageSize)
+	listPageSize = 2
+
+	objects := map[string]string{
+		"config-a-abc":  "config-a",
+		"config-b-abc":  "config-b",
+		"config-c-abc":  "config-c",
+		"my-config-abc": "my-config",
+		"my-config-def": "my-config",
+	}
+	for name, realname := range objects {
+		createConfigMapWithRealname(t, namespace, name, realname, time.Time{})
+	}
+
+	info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config")
+	if err == nil || err.Error() != "multiple objects have same realname label: realname=my-config" {
+		t.Errorf("expected multiple objects error, got: %v", err)
+	}
+}
+
+// TestGetWithRealName_UserSelector tests that live candidates must also match the user's label selector
+func TestGetWithRealName_UserSelector(t *testing.T) {
+	namespace := setupTestNamespace(t)
+
+	for name, env := range map[string]string{"my-config-abc": "staging", "my-config-def": "prod"} {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels: map[string]string{
+					realNameLabel: "my-config",
+					"env":         env,
+				},
+			},
+		}
+		if err := k8sClient.Create(context.Background(), cm); err != nil {
+			t.Fatalf("failed to create ConfigMap: %v", err)
+		}
+	}
+
+	info := createResourceInfo(t, namespace, corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+	lookup := &realnameLookup{strategy: targetSelectionStrategyError, selector: "env=prod"}
+	if err := lookup.getWithRealName(info, info.Object.(*unstructured.Unstructured), "my-config"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertResourceMatches(t, info, "my-config-def", "my-config")
+}
+
+// createClusterScoped creates a cluster-scoped object in the API server and deletes it after the test
+func createClusterScoped(t *testing.T, obj client.Object) {
+	t.Helper()
+
+	if err := k8sClient.Create(context.Background(), obj); err != nil {
+		t.Fatalf("failed to create %T: %v", obj, err)
+	}
+	t.Cleanup(func() {
+		if err := k8sClient.Delete(context.Background(), obj); err != nil && !errors.IsNotFound(err) {
+			t.Logf("warning: failed to delete %s: %v", obj.GetName(), err)
+		}
+	})
+}
+
+// TestGetWithRealName_ClusterScoped tests getWithRealName with cluster-scoped resources
+func TestGetWithRealName_ClusterScoped(t *testing.T) {
+	tests := []struct {
+		name string
+		gvk  schema.GroupVersionKind
+		obj  func(name, realname string) client.Object
+	}{
+		{
+			name: "ClusterRole",
+			gvk:  rbacv1.SchemeGroupVersion.WithKind("ClusterRole"),
+			obj: func(name, realname string) client.Object {
+				return &rbacv1.ClusterRole{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{realNameLabel: realname}},
+				}
+			},
+		},
+		{
+			name: "PriorityClass",
+			gvk:  schedulingv1.SchemeGroupVersion.WithKind("PriorityClass"),
+			obj: func(name, realname string) client.Object {
+				return &schedulingv1.PriorityClass{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{realNameLabel: realname}},
+					Value:      1000,
+				}
+			},
+		},
+		{
+			name: "ValidatingWebhookConfiguration",
+			gvk:  admissionregistrationv1.SchemeGroupVersion.WithKind("ValidatingWebhookConfiguration"),
+			obj: func(name, realname string) client.Object {
+				return &admissionregistrationv1.ValidatingWebhookConfiguration{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{realNameLabel: realname}},
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			realname := "realname-" + utilrand.String(8)
+			createClusterScoped(t, tt.obj(realname+"-abc123", realname))
+
+			// The namespace given to a cluster-scoped object is ignored
+			info := createResourceInfo(t, "default", tt.gvk)
+			err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), realname)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			assertResourceMatches(t, info, realname+"-abc123", realname)
+			assertResourceVersionCaptured(t, info)
+		})
+	}
+}
+
+// TestRealnameDiffInfoObject_Merged_ClusterScoped tests the rename-aware Merged() with a cluster-scoped resource
+func TestRealnameDiffInfoObject_Merged_ClusterScoped(t *testing.T) {
+	realname := "reader-" + utilrand.String(8)
+	createClusterScoped(t, &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: realname + "-abc123", Labels: map[string]string{realNameLabel: realname}},
+	})
+
+	local := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind":       "ClusterRole",
+			"metadata": map[string]interface{}{
+				"name":   realname + "-def456",
+				"labels": map[string]interface{}{realNameLabel: realname},
+			},
+			"rules": []interface{}{
+				map[string]interface{}{
+					"apiGroups": []interface{}{""},
+					"resources": []interface{}{"configmaps"},
+					"verbs":     []interface{}{"get"},
+				},
+			},
+		},
+	}
+
+	info := createResourceInfo(t, "", rbacv1.SchemeGroupVersion.WithKind("ClusterRole"))
+	info.Name = local.GetName()
+	info.Object = local.DeepCopyObject()
+	if err := (&realnameLookup{strategy: targetSelectionStrategyError}).getWithRealName(info, info.Object.(*unstructured.Unstructured), realname); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	obj := RealnameDiffInfoObject{
+		infoObj: diff.InfoObject{
+			LocalObj: local,
+			Info:     info,
+		},
+	}
+	if !obj.nameChanged() {
+		t.Fatal("expected the name to be changed")
+	}
+
+	merged, err := obj.Merged()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mergedObj := merged.(*unstructured.Unstructured)
+	if mergedObj.GetName() != realname+"-def456" {
+		t.Errorf("expected merged name %q, got %q", realname+"-def456", mergedObj.GetName())
+	}
+	if mergedObj.GetNamespace() != "" {
+		t.Errorf("expected no namespace, got %q", mergedObj.GetNamespace())
+	}
+	rules, _, _ := unstructured.NestedSlice(mergedObj.Object, "rules")
+	if len(rules) != 1 {
+		t.Errorf("expected the local rules to be merged, got %v", rules)
+	}
+
+	// Merged() must not create the object
+	err = k8sClient.Get(context.Background(), client.ObjectKey{Name: realname + "-def456"}, &rbacv1.ClusterRole{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected the object not to be created, got: %v", err)
+	}
+}
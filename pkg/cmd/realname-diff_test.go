@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -267,3 +269,33 @@ func Test_RealnameDiffInfoObject_Live(t *testing.T) {
 		})
 	}
 }
+
+// Test_visitInfos tests visiting the infos until one of them fails
+func Test_visitInfos(t *testing.T) {
+	infos := []*resource.Info{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+
+	for _, concurrency := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			var mu sync.Mutex
+			visited := map[string]bool{}
+			err := visitInfos(infos, concurrency, func(info *resource.Info) error {
+				mu.Lock()
+				defer mu.Unlock()
+				visited[info.Name] = true
+				if info.Name == "b" {
+					return fmt.Errorf("failed")
+				}
+				return nil
+			})
+			if err == nil || err.Error() != "failed" {
+				t.Errorf("expected the error of the visit, got %v", err)
+			}
+			if !visited["b"] {
+				t.Errorf("expected the failing info to be visited, got %v", visited)
+			}
+			if concurrency <= 1 && (!visited["a"] || visited["c"]) {
+				t.Errorf("expected the infos to be visited in order until the error, got %v", visited)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// workloadResources are the resources whose pods may reference ConfigMaps and
+// Secrets.
+var workloadResources = []schema.GroupVersionResource{
+	{Group: "", Version: "v1", Resource: "pods"},
+	{Group: "", Version: "v1", Resource: "replicationcontrollers"},
+	{Group: "apps", Version: "v1", Resource: "deployments"},
+	{Group: "apps", Version: "v1", Resource: "replicasets"},
+	{Group: "apps", Version: "v1", Resource: "statefulsets"},
+	{Group: "apps", Version: "v1", Resource: "daemonsets"},
+	{Group: "batch", Version: "v1", Resource: "jobs"},
+	{Group: "batch", Version: "v1", Resource: "cronjobs"},
+}
+
+// objectRef identifies a ConfigMap or a Secret referenced by workloads.
+type objectRef struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// referenceIndex holds the workloads referencing each ConfigMap and Secret. The
+// workloads are described as "Kind/name".
+type referenceIndex map[objectRef][]string
+
+// referrers returns the workloads referencing the object, sorted by name.
+func (idx referenceIndex) referrers(kind, namespace, name string) []string {
+	referrers := append([]string(nil), idx[objectRef{kind: kind, namespace: namespace, name: name}]...)
+	sort.Strings(referrers)
+	return referrers
+}
+
+// add indexes the ConfigMaps and Secrets referenced by the workload object. Objects
+// other than workloads are ignored.
+func (idx referenceIndex) add(obj *unstructured.Unstructured) error {
+	return idx.addReferences(obj, false)
+}
+
+// addRequired indexes the ConfigMaps and Secrets referenced by the workload object
+// which are not marked as optional, and so must exist for the pods to start.
+func (idx referenceIndex) addRequired(obj *unstructured.Unstructured) error {
+	return idx.addReferences(obj, true)
+}
+
+func (idx referenceIndex) addReferences(obj *unstructured.Unstructured, skipOptional bool) error {
+	spec, err := podSpecOf(obj)
+	if err != nil || spec == nil {
+		return err
+	}
+
+	referrer := obj.GetKind() + "/" + obj.GetName()
+	configMaps, secrets := podSpecReferences(spec, skipOptional)
+	for _, name := range configMaps {
+		ref := objectRef{kind: "ConfigMap", namespace: obj.GetNamespace(), name: name}
+		idx[ref] = appendUnique(idx[ref], referrer)
+	}
+	for _, name := range secrets {
+		ref := objectRef{kind: "Secret", namespace: obj.GetNamespace(), name: name}
+		idx[ref] = appendUnique(idx[ref], referrer)
+	}
+	return nil
+}
+
+func appendUnique(s []string, v string) []string {
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
+
+// podSpecOf returns the pod spec of the workload object, or nil if the object is
+// not a workload.
+func podSpecOf(obj *unstructured.Unstructured) (*corev1.PodSpec, error) {
+	var fields []string
+	switch obj.GroupVersionKind().GroupKind() {
+	case schema.GroupKind{Kind: "Pod"}:
+		fields = []string{"spec"}
+	case schema.GroupKind{Group: "batch", Kind: "CronJob"}:
+		fields = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	case schema.GroupKind{Kind: "ReplicationController"},
+		schema.GroupKind{Group: "apps", Kind: "Deployment"},
+		schema.GroupKind{Group: "apps", Kind: "ReplicaSet"},
+		schema.GroupKind{Group: "apps", Kind: "StatefulSet"},
+		schema.GroupKind{Group: "apps", Kind: "DaemonSet"},
+		schema.GroupKind{Group: "batch", Kind: "Job"}:
+		fields = []string{"spec", "template", "spec"}
+	default:
+		return nil, nil
+	}
+
+	m, found, err := unstructured.NestedMap(obj.Object, fields...)
+	if err != nil || !found {
+		return nil, err
+	}
+	spec := &corev1.PodSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m, spec); err != nil {
+		return nil, fmt.Errorf("failed to read the pod spec of %s %s: %v", obj.GetKind(), obj.GetName(), err)
+	}
+	return spec, nil
+}
+
+// podSpecReferences returns the names of the ConfigMaps and Secrets referenced by
+// the pod spec through volumes, projected volumes, envFrom, env valueFrom and
+// imagePullSecrets. With skipOptional, the references marked as optional are not
+// returned.
+func podSpecReferences(spec *corev1.PodSpec, skipOptional bool) (configMaps, secrets []string) {
+	required := func(optional *bool) bool {
+		return !skipOptional || optional == nil || !*optional
+	}
+
+	for _, v := range spec.Volumes {
+		if v.ConfigMap != nil && required(v.ConfigMap.Optional) {
+			configMaps = append(configMaps, v.ConfigMap.Name)
+		}
+		if v.Secret != nil && required(v.Secret.Optional) {
+			secrets = append(secrets, v.Secret.SecretName)
+		}
+		if v.Projected != nil {
+			for _, source := range v.Projected.Sources {
+				if source.ConfigMap != nil && required(source.ConfigMap.Optional) {
+					configMaps = append(configMaps, source.ConfigMap.Name)
+				}
+				if source.Secret != nil && required(source.Secret.Optional) {
+					secrets = append(secrets, source.Secret.Name)
+				}
+			}
+		}
+	}
+
+	var containers []corev1.Container
+	containers = append(containers, spec.InitContainers...)
+	containers = append(containers, spec.Containers...)
+	for _, c := range spec.EphemeralContainers {
+		containers = append(containers, corev1.Container(c.EphemeralContainerCommon))
+	}
+	for _, c := range containers {
+		for _, envFrom := range c.EnvFrom {
+			if envFrom.ConfigMapRef != nil && required(envFrom.ConfigMapRef.Optional) {
+				configMaps = append(configMaps, envFrom.ConfigMapRef.Name)
+			}
+			if envFrom.SecretRef != nil && required(envFrom.SecretRef.Optional) {
+				secrets = append(secrets, envFrom.SecretRef.Name)
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil && required(env.ValueFrom.ConfigMapKeyRef.Optional) {
+				configMaps = append(configMaps, env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+			if env.ValueFrom.SecretKeyRef != nil && required(env.ValueFrom.SecretKeyRef.Optional) {
+				secrets = append(secrets, env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+
+	for _, s := range spec.ImagePullSecrets {
+		secrets = append(secrets, s.Name)
+	}
+	return configMaps, secrets
+}
+
+// isActiveWorkload reports whether the live workload object may still run pods
+// using its references. ReplicaSets scaled to zero (kept only as rollout history)
+// and finished pods are not active.
+func isActiveWorkload(obj *unstructured.Unstructured) bool {
+	switch obj.GroupVersionKind().GroupKind() {
+	case schema.GroupKind{Group: "apps", Kind: "ReplicaSet"}, schema.GroupKind{Kind: "ReplicationController"}:
+		replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+		return !found || replicas > 0
+	case schema.GroupKind{Kind: "Pod"}:
+		phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+		return phase != string(corev1.PodSucceeded) && phase != string(corev1.PodFailed)
+	}
+	return true
+}
+
+// listWorkloadReferences lists the active live workloads in the namespace and adds
+// their references to the index. Workloads for which skip returns true are ignored.
+func listWorkloadReferences(client dynamic.Interface, namespace string, idx referenceIndex, skip func(*unstructured.Unstructured) bool) error {
+	for _, gvr := range workloadResources {
+		list, err := client.Resource(gvr).Namespace(namespace).List(context.TODO(), metav1.ListOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if !isActiveWorkload(obj) || (skip != nil && skip(obj)) {
+				continue
+			}
+			if err := idx.add(obj); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// referenceChecker collects the references of the local workloads, and the local
+// ConfigMaps and Secrets, to find the references which will point at nothing after
+// applying the input.
+type referenceChecker struct {
+	mu      sync.Mutex
+	refs    referenceIndex
+	objects map[objectRef]bool
+}
+
+func newReferenceChecker() *referenceChecker {
+	return &referenceChecker{
+		refs:    referenceIndex{},
+		objects: map[objectRef]bool{},
+	}
+}
+
+// add records the local object: the references if it is a workload, or the object
+// itself if it is a ConfigMap or a Secret.
+func (c *referenceChecker) add(local *unstructured.Unstructured) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch local.GroupVersionKind().GroupKind() {
+	case schema.GroupKind{Kind: "ConfigMap"}, schema.GroupKind{Kind: "Secret"}:
+		c.objects[objectRef{kind: local.GetKind(), namespace: local.GetNamespace(), name: local.GetName()}] = true
+		return nil
+	}
+	return c.refs.addRequired(local)
+}
+
+// danglingReference is a reference of local workloads to a ConfigMap or a Secret
+// which is neither in the input nor live.
+type danglingReference struct {
+	ref       objectRef
+	referrers []string
+
+	// err is the error of looking up the live object, if it could not be checked.
+	err error
+}
+
+// dangling returns the references to the objects which are neither local nor live,
+// and the ones which could not be looked up, sorted by kind, namespace and name.
+// live reports whether the object exists. References without a name are ignored,
+// since they are rejected by the server anyway.
+func (c *referenceChecker) dangling(live func(objectRef) (bool, error)) []danglingReference {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var dangling []danglingReference
+	for ref := range c.refs {
+		if len(ref.name) == 0 || c.objects[ref] {
+			continue
+		}
+		exists, err := live(ref)
+		if err != nil || !exists {
+			dangling = append(dangling, danglingReference{ref: ref, referrers: c.refs.referrers(ref.kind, ref.namespace, ref.name), err: err})
+		}
+	}
+
+	sort.Slice(dangling, func(i, j int) bool {
+		a, b := dangling[i].ref, dangling[j].ref
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		return a.name < b.name
+	})
+	return dangling
+}
+
+// liveObjectExists reports whether the referenced ConfigMap or Secret exists in the
+// cluster, or in the directory given by --live-from.
+func (o *RealnameDiffOptions) liveObjectExists(ref objectRef) (bool, error) {
+	if o.live != nil {
+		_, ok := o.live.objects[objectKey{groupKind: schema.GroupKind{Kind: ref.kind}, namespace: ref.namespace, name: ref.name}]
+		return ok, nil
+	}
+
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	if ref.kind == "Secret" {
+		gvr.Resource = "secrets"
+	}
+	_, err := o.dynamicClient.Resource(gvr).Namespace(ref.namespace).Get(context.TODO(), ref.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
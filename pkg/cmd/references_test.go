@@ -0,0 +1,287 @@
+package cmd
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// newWorkload creates a workload object of the kind whose pod template has the pod spec
+func newWorkload(apiVersion, kind, name string, podSpec map[string]interface{}) *unstructured.Unstructured {
+	spec := map[string]interface{}{
+		"template": map[string]interface{}{"spec": podSpec},
+	}
+	switch kind {
+	case "Pod":
+		spec = podSpec
+	case "CronJob":
+		spec = map[string]interface{}{
+			"jobTemplate": map[string]interface{}{"spec": spec},
+		}
+	}
+
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": "default",
+			},
+			"spec": spec,
+		},
+	}
+}
+
+// newPodSpecWithConfigMapVolume creates a pod spec mounting the ConfigMap
+func newPodSpecWithConfigMapVolume(configMap string) map[string]interface{} {
+	return map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{"name": "app", "image": "nginx"},
+		},
+		"volumes": []interface{}{
+			map[string]interface{}{
+				"name":      "conf",
+				"configMap": map[string]interface{}{"name": configMap},
+			},
+		},
+	}
+}
+
+// Test_podSpecReferences tests collecting the ConfigMaps and Secrets referenced by a pod spec
+func Test_podSpecReferences(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Volumes: []corev1.Volume{
+			{Name: "a", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "cm-volume"}}}},
+			{Name: "b", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "secret-volume"}}},
+			{Name: "c", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+				{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "cm-projected"}}},
+				{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "secret-projected"}}},
+			}}}},
+		},
+		InitContainers: []corev1.Container{{
+			Name: "init",
+			EnvFrom: []corev1.EnvFromSource{
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "cm-envfrom"}}},
+			},
+		}},
+		Containers: []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "secret-envfrom"}}},
+			},
+			Env: []corev1.EnvVar{
+				{Name: "A", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "cm-env"}, Key: "a"}}},
+				{Name: "B", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "secret-env"}, Key: "b"}}},
+				{Name: "C", Value: "plain"},
+			},
+		}},
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "secret-pull"}},
+	}
+
+	configMaps, secrets := podSpecReferences(spec, false)
+
+	expectedConfigMaps := []string{"cm-volume", "cm-projected", "cm-envfrom", "cm-env"}
+	if !reflect.DeepEqual(configMaps, expectedConfigMaps) {
+		t.Errorf("podSpecReferences() configMaps = %v, want %v", configMaps, expectedConfigMaps)
+	}
+	expectedSecrets := []string{"secret-volume", "secret-projected", "secret-envfrom", "secret-env", "secret-pull"}
+	if !reflect.DeepEqual(secrets, expectedSecrets) {
+		t.Errorf("podSpecReferences() secrets = %v, want %v", secrets, expectedSecrets)
+	}
+}
+
+// Test_podSpecReferences_skipOptional tests skipping the references marked as optional
+func Test_podSpecReferences_skipOptional(t *testing.T) {
+	optional := true
+	ref := func(name string) corev1.LocalObjectReference {
+		return corev1.LocalObjectReference{Name: name}
+	}
+	spec := &corev1.PodSpec{
+		Volumes: []corev1.Volume{
+			{Name: "a", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: ref("cm-volume"), Optional: &optional}}},
+			{Name: "b", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "secret-volume", Optional: &optional}}},
+			{Name: "c", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+				{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: ref("cm-projected"), Optional: &optional}},
+				{Secret: &corev1.SecretProjection{LocalObjectReference: ref("secret-projected"), Optional: &optional}},
+			}}}},
+		},
+		Containers: []corev1.Container{{
+			Name: "app",
+			EnvFrom: []corev1.EnvFromSource{
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: ref("cm-envfrom"), Optional: &optional}},
+				{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: ref("secret-envfrom"), Optional: &optional}},
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: ref("cm-required")}},
+			},
+			Env: []corev1.EnvVar{
+				{Name: "A", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{LocalObjectReference: ref("cm-env"), Key: "a", Optional: &optional}}},
+				{Name: "B", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: ref("secret-env"), Key: "b", Optional: &optional}}},
+			},
+		}},
+		ImagePullSecrets: []corev1.LocalObjectReference{ref("secret-pull")},
+	}
+
+	configMaps, secrets := podSpecReferences(spec, true)
+	if expected := []string{"cm-required"}; !reflect.DeepEqual(configMaps, expected) {
+		t.Errorf("podSpecReferences() configMaps = %v, want %v", configMaps, expected)
+	}
+	if expected := []string{"secret-pull"}; !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("podSpecReferences() secrets = %v, want %v", secrets, expected)
+	}
+
+	configMaps, secrets = podSpecReferences(spec, false)
+	if len(configMaps) != 5 || len(secrets) != 5 {
+		t.Errorf("expected the optional references without skipOptional, got %v and %v", configMaps, secrets)
+	}
+}
+
+// Test_referenceIndex_add tests indexing the references of workloads of each kind
+func Test_referenceIndex_add(t *testing.T) {
+	tests := []struct {
+		name       string
+		obj        *unstructured.Unstructured
+		referrer   string
+		referenced bool
+	}{
+		{
+			name:       "Deployment",
+			obj:        newWorkload("apps/v1", "Deployment", "nginx", newPodSpecWithConfigMapVolume("nginx-conf-abc")),
+			referrer:   "Deployment/nginx",
+			referenced: true,
+		},
+		{
+			name:       "CronJob",
+			obj:        newWorkload("batch/v1", "CronJob", "backup", newPodSpecWithConfigMapVolume("nginx-conf-abc")),
+			referrer:   "CronJob/backup",
+			referenced: true,
+		},
+		{
+			name:       "Pod",
+			obj:        newWorkload("v1", "Pod", "nginx-xyz", newPodSpecWithConfigMapVolume("nginx-conf-abc")),
+			referrer:   "Pod/nginx-xyz",
+			referenced: true,
+		},
+		{
+			name:       "not a workload",
+			obj:        newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", time.Now()),
+			referenced: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := referenceIndex{}
+			if err := idx.add(tt.obj); err != nil {
+				t.Fatalf("add() returned error: %v", err)
+			}
+
+			referrers := idx.referrers("ConfigMap", "default", "nginx-conf-abc")
+			if !tt.referenced {
+				if len(referrers) != 0 {
+					t.Errorf("expected no referrers, got %v", referrers)
+				}
+				return
+			}
+			if !reflect.DeepEqual(referrers, []string{tt.referrer}) {
+				t.Errorf("referrers() = %v, want %v", referrers, []string{tt.referrer})
+			}
+		})
+	}
+}
+
+// Test_isActiveWorkload tests which live workloads may still run pods
+func Test_isActiveWorkload(t *testing.T) {
+	scaledDown := newWorkload("apps/v1", "ReplicaSet", "nginx-old", newPodSpecWithConfigMapVolume("nginx-conf-abc"))
+	_ = unstructured.SetNestedField(scaledDown.Object, int64(0), "spec", "replicas")
+	running := newWorkload("apps/v1", "ReplicaSet", "nginx-new", newPodSpecWithConfigMapVolume("nginx-conf-abc"))
+	_ = unstructured.SetNestedField(running.Object, int64(2), "spec", "replicas")
+	succeeded := newWorkload("v1", "Pod", "job-xyz", newPodSpecWithConfigMapVolume("nginx-conf-abc"))
+	_ = unstructured.SetNestedField(succeeded.Object, "Succeeded", "status", "phase")
+
+	tests := []struct {
+		name     string
+		obj      *unstructured.Unstructured
+		expected bool
+	}{
+		{name: "ReplicaSet scaled to zero", obj: scaledDown, expected: false},
+		{name: "ReplicaSet with replicas", obj: running, expected: true},
+		{name: "succeeded Pod", obj: succeeded, expected: false},
+		{name: "Deployment", obj: newWorkload("apps/v1", "Deployment", "nginx", nil), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := isActiveWorkload(tt.obj); result != tt.expected {
+				t.Errorf("isActiveWorkload() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+// Test_referenceChecker_dangling tests finding the references to neither local nor live objects
+func Test_referenceChecker_dangling(t *testing.T) {
+	c := newReferenceChecker()
+	objects := []*unstructured.Unstructured{
+		newWorkload("apps/v1", "Deployment", "nginx", newPodSpecWithConfigMapVolume("nginx-conf-local")),
+		newWorkload("batch/v1", "CronJob", "backup", newPodSpecWithConfigMapVolume("nginx-conf-live")),
+		newWorkload("v1", "Pod", "debug", newPodSpecWithConfigMapVolume("nginx-conf-missing")),
+		newWorkload("apps/v1", "StatefulSet", "cache", newPodSpecWithConfigMapVolume("nginx-conf-missing")),
+		newConfigMapWithRealname("nginx-conf-local", "nginx-conf", time.Now()),
+	}
+	for _, obj := range objects {
+		if err := c.add(obj); err != nil {
+			t.Fatalf("add() returned error: %v", err)
+		}
+	}
+
+	var checked []string
+	dangling := c.dangling(func(ref objectRef) (bool, error) {
+		checked = append(checked, ref.name)
+		return ref.name == "nginx-conf-live", nil
+	})
+
+	expected := []danglingReference{{
+		ref:       objectRef{kind: "ConfigMap", namespace: "default", name: "nginx-conf-missing"},
+		referrers: []string{"Pod/debug", "StatefulSet/cache"},
+	}}
+	if !reflect.DeepEqual(dangling, expected) {
+		t.Errorf("dangling() = %v, want %v", dangling, expected)
+	}
+	for _, name := range checked {
+		if name == "nginx-conf-local" {
+			t.Errorf("expected the local object not to be looked up")
+		}
+	}
+}
+
+// Test_referenceChecker_dangling_unchecked tests skipping the references without a name and reporting the lookup errors
+func Test_referenceChecker_dangling_unchecked(t *testing.T) {
+	c := newReferenceChecker()
+	objects := []*unstructured.Unstructured{
+		newWorkload("apps/v1", "Deployment", "nginx", newPodSpecWithConfigMapVolume("")),
+		newWorkload("apps/v1", "Deployment", "app", newPodSpecWithConfigMapVolume("app-conf")),
+	}
+	for _, obj := range objects {
+		if err := c.add(obj); err != nil {
+			t.Fatalf("add() returned error: %v", err)
+		}
+	}
+
+	dangling := c.dangling(func(ref objectRef) (bool, error) {
+		if len(ref.name) == 0 {
+			t.Errorf("expected the reference without a name not to be looked up")
+		}
+		return false, fmt.Errorf("forbidden")
+	})
+
+	if len(dangling) != 1 {
+		t.Fatalf("expected 1 reference, got %v", dangling)
+	}
+	if dangling[0].ref.name != "app-conf" || dangling[0].err == nil || dangling[0].err.Error() != "forbidden" {
+		t.Errorf("expected the lookup error of app-conf, got %+v", dangling[0])
+	}
+}
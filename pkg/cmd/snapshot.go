@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/resource"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	snapshotLong = `Exports the live objects of the input to a directory.
+
+For each object in the input, the live object with the same name, all the live
+objects having the same real name and the one named the real name are written, so
+that the directory can be used with "kubectl realname-diff --live-from" later. Fields which change without
+changes to the configuration, such as managedFields, resourceVersion and status,
+are removed.
+
+Each object is written to DIR/NAMESPACE/RESOURCE[.GROUP]/NAME.yaml, or to
+DIR/_cluster/RESOURCE[.GROUP]/NAME.yaml if it is cluster-scoped.`
+
+	snapshotExample = `  # Export the live objects of the input
+  kubectl realname-diff snapshot -k ./example -d ./live
+
+  # Diff against them later without a cluster
+  kubectl realname-diff -k ./example --live-from ./live`
+)
+
+// volatileFields are the fields removed from the objects in a snapshot.
+var volatileFields = [][]string{
+	{"metadata", "managedFields"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "generation"},
+	{"metadata", "selfLink"},
+	{"status"},
+}
+
+func NewCmdSnapshot(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewSnapshotOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "snapshot -f FILENAME -d DIR",
+		DisableFlagsInUseLine: true,
+		Short:                 "Export the live objects of the input to a directory.",
+		Long:                  snapshotLong,
+		Example:               snapshotExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(options.Complete(factory))
+			cmdutil.CheckErr(validateArgs(cmd, args))
+			cmdutil.CheckErr(options.Run())
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&options.selector, "selector", "l", options.selector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.Flags().StringVarP(&options.dir, "dir", "d", options.dir, "Directory to write the live objects to. It must not exist or be empty.")
+	cmdutil.AddFilenameOptionFlags(cmd, &options.filenameOptions, "Contains the configuration to export the live objects of")
+
+	return cmd
+}
+
+type SnapshotOptions struct {
+	filenameOptions resource.FilenameOptions
+
+	selector string
+	dir      string
+
+	cmdNamespace     string
+	enforceNamespace bool
+	builder          *resource.Builder
+	mapper           *pendingKindMapper
+
+	genericclioptions.IOStreams
+}
+
+func NewSnapshotOptions(streams genericclioptions.IOStreams) *SnapshotOptions {
+	return &SnapshotOptions{
+		IOStreams: streams,
+	}
+}
+
+func (o *SnapshotOptions) Complete(factory cmdutil.Factory) error {
+	var err error
+
+	err = o.filenameOptions.RequireFilenameOrKustomize()
+	if err != nil {
+		return err
+	}
+
+	if len(o.dir) == 0 {
+		return fmt.Errorf("--dir is required")
+	}
+	entries, err := os.ReadDir(o.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("directory %s is not empty", o.dir)
+	}
+
+	o.cmdNamespace, o.enforceNamespace, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	o.builder, o.mapper, err = newPendingKindBuilder(factory)
+	return err
+}
+
+// snapshotPath returns the path of the object in a snapshot relative to its root.
+func snapshotPath(mapping *meta.RESTMapping, namespace, name string) string {
+	kind := mapping.Resource.Resource
+	if len(mapping.Resource.Group) > 0 {
+		kind += "." + mapping.Resource.Group
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		namespace = "_cluster"
+	}
+	return filepath.Join(namespace, kind, name+".yaml")
+}
+
+// writeSnapshotObject writes the live object to the directory without its volatile
+// fields.
+func writeSnapshotObject(dir string, mapping *meta.RESTMapping, obj *unstructured.Unstructured) error {
+	obj = obj.DeepCopy()
+	for _, field := range volatileFields {
+		unstructured.RemoveNestedField(obj.Object, field...)
+	}
+
+	data, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, snapshotPath(mapping, obj.GetNamespace(), obj.GetName()))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// snapshotNames returns the names of the live objects to write for the local object
+// of the info: its name, and if it has a real name, the names in the index having
+// it and the real name itself, since the lookup falls back to the object named so.
+// All of them are written so that they can be selected from with the same options
+// as with the cluster.
+func snapshotNames(info *resource.Info, index map[string][]metav1.PartialObjectMetadata) []string {
+	names := []string{info.Name}
+	name := realName(info.Object)
+	if len(name) == 0 {
+		return names
+	}
+	for _, item := range index[name] {
+		names = append(names, item.GetName())
+	}
+	return append(names, name)
+}
+
+func (o *SnapshotOptions) Run() error {
+	lookup := &realnameLookup{
+		selector: o.selector,
+	}
+
+	r := o.builder.
+		Unstructured().
+		NamespaceParam(o.cmdNamespace).DefaultNamespace().
+		FilenameParam(o.enforceNamespace, &o.filenameOptions).
+		LabelSelectorParam(o.selector).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	written := map[string]bool{}
+	write := func(info *resource.Info, name string) error {
+		path := snapshotPath(info.Mapping, scopeOf(info).namespace, name)
+		if written[path] {
+			return nil
+		}
+
+		obj, err := resource.NewHelper(info.Client, info.Mapping).Get(info.Namespace, name)
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeSnapshotObject(o.dir, info.Mapping, obj.(*unstructured.Unstructured)); err != nil {
+			return err
+		}
+		written[path] = true
+		return nil
+	}
+
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		// Kinds not installed yet have no live objects.
+		if o.mapper.pendingErr(info.Mapping.GroupVersionKind.GroupKind()) != nil {
+			return nil
+		}
+
+		var index map[string][]metav1.PartialObjectMetadata
+		if len(realName(info.Object)) > 0 {
+			index, err = lookup.index(info)
+			if err != nil {
+				return err
+			}
+		}
+		for _, name := range snapshotNames(info, index) {
+			if err := write(info, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(o.Out, "%d object(s) written to %s\n", len(written), o.dir)
+	return nil
+}
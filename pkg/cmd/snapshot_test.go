@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// Test_snapshotPath tests the layout of the objects in a snapshot
+func Test_snapshotPath(t *testing.T) {
+	clusterRoleMapping := &meta.RESTMapping{
+		Resource:         schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"},
+		GroupVersionKind: schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+		Scope:            meta.RESTScopeRoot,
+	}
+
+	tests := []struct {
+		name      string
+		mapping   *meta.RESTMapping
+		namespace string
+		expected  string
+	}{
+		{
+			name:      "namespaced core kind",
+			mapping:   configMapMapping,
+			namespace: "default",
+			expected:  filepath.Join("default", "configmaps", "nginx-conf-abc.yaml"),
+		},
+		{
+			name:     "cluster-scoped kind with group",
+			mapping:  clusterRoleMapping,
+			expected: filepath.Join("_cluster", "clusterroles.rbac.authorization.k8s.io", "nginx-conf-abc.yaml"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := snapshotPath(tt.mapping, tt.namespace, "nginx-conf-abc"); result != tt.expected {
+				t.Errorf("snapshotPath() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+// Test_writeSnapshotObject tests that written objects have no volatile fields and can be read with --live-from
+func Test_writeSnapshotObject(t *testing.T) {
+	dir := t.TempDir()
+	created := time.Date(2021, 12, 23, 15, 0, 12, 0, time.UTC)
+	live := newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", created)
+	live.SetResourceVersion("42")
+	live.SetGeneration(3)
+	live.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationApply}})
+
+	if err := writeSnapshotObject(dir, configMapMapping, live); err != nil {
+		t.Fatalf("writeSnapshotObject() returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "default", "configmaps", "nginx-conf-abc.yaml")); err != nil {
+		t.Fatalf("expected the object to be written: %v", err)
+	}
+	if live.GetResourceVersion() != "42" {
+		t.Errorf("expected the live object not to be modified")
+	}
+
+	s, err := loadLiveSnapshot(dir)
+	if err != nil {
+		t.Fatalf("loadLiveSnapshot() returned error: %v", err)
+	}
+	info := &resource.Info{Mapping: configMapMapping, Namespace: "default"}
+	obj, err := s.get(info, "nginx-conf-abc")
+	if err != nil {
+		t.Fatalf("get() returned error: %v", err)
+	}
+
+	read := obj.(*unstructured.Unstructured)
+	if read.GetResourceVersion() != "" || read.GetGeneration() != 0 || read.GetManagedFields() != nil {
+		t.Errorf("expected the volatile fields to be removed, got %v", read.Object["metadata"])
+	}
+	if timestamp := read.GetCreationTimestamp(); !timestamp.Equal(&metav1.Time{Time: created}) {
+		t.Errorf("expected the creation timestamp to be kept, got %v", timestamp)
+	}
+	if realName(read) != "nginx-conf" {
+		t.Errorf("expected the real name label to be kept, got %v", read.GetLabels())
+	}
+}
+
+// Test_snapshotNames tests writing the object named the real name as well as the ones having it
+func Test_snapshotNames(t *testing.T) {
+	index := map[string][]metav1.PartialObjectMetadata{
+		"nginx-conf": {
+			{ObjectMeta: metav1.ObjectMeta{Name: "nginx-conf-abc"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "nginx-conf-def"}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		obj      *unstructured.Unstructured
+		expected []string
+	}{
+		{
+			name:     "with a real name",
+			obj:      newConfigMapWithRealname("nginx-conf-ghi", "nginx-conf", time.Now()),
+			expected: []string{"nginx-conf-ghi", "nginx-conf-abc", "nginx-conf-def", "nginx-conf"},
+		},
+		{
+			name: "without a real name",
+			obj: func() *unstructured.Unstructured {
+				obj := newConfigMapWithRealname("nginx-conf-ghi", "nginx-conf", time.Now())
+				obj.SetLabels(nil)
+				return obj
+			}(),
+			expected: []string{"nginx-conf-ghi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &resource.Info{Name: tt.obj.GetName(), Object: tt.obj}
+			if names := snapshotNames(info, index); !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("snapshotNames() = %v, want %v", names, tt.expected)
+			}
+		})
+	}
+}
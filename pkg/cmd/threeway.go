@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubectl/pkg/cmd/diff"
+)
+
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// driftDiffer writes the last applied configurations and the live objects, to show
+// the changes made to the live objects out of band with --three-way.
+type driftDiffer struct {
+	lastApplied *diff.DiffVersion
+	live        *diff.DiffVersion
+}
+
+func newDriftDiffer() (*driftDiffer, error) {
+	lastApplied, err := diff.NewDiffVersion("LAST-APPLIED")
+	if err != nil {
+		return nil, err
+	}
+	live, err := diff.NewDiffVersion("LIVE")
+	if err != nil {
+		_ = os.RemoveAll(lastApplied.Dir.Name)
+		return nil, err
+	}
+	return &driftDiffer{lastApplied: lastApplied, live: live}, nil
+}
+
+// lastApplied returns the last applied configuration of the live object, or nil if
+// it has none.
+func lastApplied(live *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	annotation, ok := live.GetAnnotations()[lastAppliedAnnotation]
+	if !ok {
+		return nil, nil
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal([]byte(annotation), &obj.Object); err != nil {
+		return nil, fmt.Errorf("invalid %s annotation of %s/%s: %v", lastAppliedAnnotation, live.GetKind(), live.GetName(), err)
+	}
+	return obj, nil
+}
+
+// projectOnto returns the parts of the live value which are in the shape of the
+// applied value: the keys of maps in the applied value, and the items of lists with
+// the same length. The fields only in the live value, such as the defaults and the
+// status, are not returned.
+func projectOnto(live, applied interface{}) interface{} {
+	switch applied := applied.(type) {
+	case map[string]interface{}:
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		projected := map[string]interface{}{}
+		for key, value := range applied {
+			if liveValue, ok := liveMap[key]; ok {
+				projected[key] = projectOnto(liveValue, value)
+			}
+		}
+		return projected
+
+	case []interface{}:
+		liveList, ok := live.([]interface{})
+		if !ok || len(liveList) != len(applied) {
+			return live
+		}
+		projected := make([]interface{}, len(liveList))
+		for i := range liveList {
+			projected[i] = projectOnto(liveList[i], applied[i])
+		}
+		return projected
+	}
+	return live
+}
+
+// foldStringData moves the stringData of the Secret into its data encoded, as the
+// server does when writing it. The masker only masks data, and live Secrets never
+// have stringData.
+func foldStringData(obj *unstructured.Unstructured) error {
+	if gvk := obj.GroupVersionKind(); gvk.Group != "" || gvk.Kind != "Secret" {
+		return nil
+	}
+	stringData, found, err := unstructured.NestedStringMap(obj.Object, "stringData")
+	if err != nil || !found {
+		return err
+	}
+
+	data, _, err := unstructured.NestedMap(obj.Object, "data")
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	for key, value := range stringData {
+		data[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	unstructured.RemoveNestedField(obj.Object, "stringData")
+	return unstructured.SetNestedMap(obj.Object, data, "data")
+}
+
+// add writes the last applied configuration of the live object and the live object
+// in its shape. ok is false if the live object has no last applied configuration.
+func (d *driftDiffer) add(name string, live *unstructured.Unstructured, printer diff.Printer) (ok bool, err error) {
+	applied, err := lastApplied(live)
+	if err != nil || applied == nil {
+		return false, err
+	}
+	if err := foldStringData(applied); err != nil {
+		return false, err
+	}
+	projected := &unstructured.Unstructured{
+		Object: projectOnto(live.DeepCopy().Object, applied.Object).(map[string]interface{}),
+	}
+
+	var from, to runtime.Object = applied, projected
+	if gvk := live.GroupVersionKind(); gvk.Version == "v1" && gvk.Kind == "Secret" {
+		m, err := diff.NewMasker(applied, projected)
+		if err != nil {
+			return false, err
+		}
+		from, to = m.From(), m.To()
+	}
+
+	if err := d.lastApplied.Print(name, from, printer); err != nil {
+		return false, err
+	}
+	return true, d.live.Print(name, to, printer)
+}
+
+// run runs the diff program against the last applied configurations and the live
+// objects.
+func (d *driftDiffer) run(program *diff.DiffProgram) error {
+	return program.Run(d.lastApplied.Dir.Name, d.live.Dir.Name)
+}
+
+func (d *driftDiffer) tearDown() {
+	_ = os.RemoveAll(d.lastApplied.Dir.Name)
+	_ = os.RemoveAll(d.live.Dir.Name)
+}
+
+// runThreeWay runs the diff program against the drift, then against the changes. The
+// diff program exits with 1 if either of them has differences.
+func (o *RealnameDiffOptions) runThreeWay(drift *driftDiffer, differ *diff.Differ) error {
+	fmt.Fprintln(o.diffProgram.ErrOut, "Drift from the last applied configurations to the live objects:")
+	driftErr := drift.run(o.diffProgram)
+	if driftErr != nil && diffError(driftErr) == nil {
+		return driftErr
+	}
+
+	fmt.Fprintln(o.diffProgram.ErrOut, "Changes from the live objects to the merged objects:")
+	if err := differ.Run(o.diffProgram); err != nil {
+		return err
+	}
+	return driftErr
+}
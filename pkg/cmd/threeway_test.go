@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/kubectl/pkg/cmd/diff"
+)
+
+// Test_projectOnto tests taking only the fields in the shape of the applied value from the live value
+func Test_projectOnto(t *testing.T) {
+	tests := []struct {
+		name     string
+		live     interface{}
+		applied  interface{}
+		expected interface{}
+	}{
+		{
+			name:     "fields only in the live value are removed",
+			live:     map[string]interface{}{"replicas": int64(3), "revisionHistoryLimit": int64(10)},
+			applied:  map[string]interface{}{"replicas": int64(2)},
+			expected: map[string]interface{}{"replicas": int64(3)},
+		},
+		{
+			name:     "fields removed from the live value are missing",
+			live:     map[string]interface{}{},
+			applied:  map[string]interface{}{"replicas": int64(2)},
+			expected: map[string]interface{}{},
+		},
+		{
+			name: "lists with the same length are projected item by item",
+			live: []interface{}{
+				map[string]interface{}{"name": "nginx", "image": "nginx:1.2", "imagePullPolicy": "Always"},
+			},
+			applied: []interface{}{
+				map[string]interface{}{"name": "nginx", "image": "nginx:1.1"},
+			},
+			expected: []interface{}{
+				map[string]interface{}{"name": "nginx", "image": "nginx:1.2"},
+			},
+		},
+		{
+			name:     "lists with different lengths are kept",
+			live:     []interface{}{"a", "b"},
+			applied:  []interface{}{"a"},
+			expected: []interface{}{"a", "b"},
+		},
+		{
+			name:     "values of different types are kept",
+			live:     "value",
+			applied:  map[string]interface{}{"key": "value"},
+			expected: "value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := projectOnto(tt.live, tt.applied); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("projectOnto() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+// Test_lastApplied tests reading the last applied configuration from the annotation
+func Test_lastApplied(t *testing.T) {
+	live := newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", time.Now())
+	if applied, err := lastApplied(live); err != nil || applied != nil {
+		t.Errorf("expected nil without the annotation, got %v (%v)", applied, err)
+	}
+
+	live.SetAnnotations(map[string]string{lastAppliedAnnotation: `{"apiVersion":"v1","kind":"ConfigMap","data":{"test":"applied"}}`})
+	applied, err := lastApplied(live)
+	if err != nil {
+		t.Fatalf("lastApplied() returned error: %v", err)
+	}
+	if data, _, _ := unstructured.NestedString(applied.Object, "data", "test"); data != "applied" {
+		t.Errorf("expected the applied data, got %q", data)
+	}
+
+	live.SetAnnotations(map[string]string{lastAppliedAnnotation: "{"})
+	if _, err := lastApplied(live); err == nil {
+		t.Errorf("expected error for an invalid annotation but got nil")
+	}
+}
+
+// Test_driftDiffer_add tests writing the drift with the values of Secrets masked
+func Test_driftDiffer_add(t *testing.T) {
+	d, err := newDriftDiffer()
+	if err != nil {
+		t.Fatalf("newDriftDiffer() returned error: %v", err)
+	}
+	defer d.tearDown()
+
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":            "htpasswd",
+			"namespace":       "default",
+			"resourceVersion": "42",
+			"annotations": map[string]interface{}{
+				lastAppliedAnnotation: `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"htpasswd","namespace":"default"},"data":{"auth":"YXBwbGllZA=="}}`,
+			},
+		},
+		"data": map[string]interface{}{"auth": "ZWRpdGVk"},
+	}}
+
+	ok, err := d.add("v1.Secret.default.htpasswd", secret, diff.Printer{})
+	if err != nil || !ok {
+		t.Fatalf("add() = (%v, %v), want (true, nil)", ok, err)
+	}
+
+	for dir, expected := range map[string]string{
+		d.lastApplied.Dir.Name: "*** (before)",
+		d.live.Dir.Name:        "*** (after)",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, "v1.Secret.default.htpasswd"))
+		if err != nil {
+			t.Fatalf("failed to read the written object: %v", err)
+		}
+		if !strings.Contains(string(data), expected) || strings.Contains(string(data), "ZWRpdGVk") || strings.Contains(string(data), "YXBwbGllZA==") {
+			t.Errorf("expected the data to be masked as %q, got:\n%s", expected, data)
+		}
+		if strings.Contains(string(data), "resourceVersion") {
+			t.Errorf("expected only the fields in the last applied configuration, got:\n%s", data)
+		}
+	}
+
+	stringData := secret.DeepCopy()
+	stringData.SetName("basic-auth")
+	stringData.SetAnnotations(map[string]string{
+		lastAppliedAnnotation: `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"basic-auth","namespace":"default"},"stringData":{"password":"cleartext"}}`,
+	})
+	_ = unstructured.SetNestedStringMap(stringData.Object, map[string]string{"password": "ZWRpdGVk"}, "data")
+	ok, err = d.add("v1.Secret.default.basic-auth", stringData, diff.Printer{})
+	if err != nil || !ok {
+		t.Fatalf("add() = (%v, %v), want (true, nil)", ok, err)
+	}
+	for dir, expected := range map[string]string{
+		d.lastApplied.Dir.Name: "*** (before)",
+		d.live.Dir.Name:        "*** (after)",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, "v1.Secret.default.basic-auth"))
+		if err != nil {
+			t.Fatalf("failed to read the written object: %v", err)
+		}
+		if !strings.Contains(string(data), expected) || strings.Contains(string(data), "cleartext") || strings.Contains(string(data), "stringData") {
+			t.Errorf("expected the stringData to be masked as %q in data, got:\n%s", expected, data)
+		}
+	}
+
+	ok, err = d.add("v1.ConfigMap.default.nginx-conf-abc", newConfigMapWithRealname("nginx-conf-abc", "nginx-conf", time.Now()), diff.Printer{})
+	if err != nil || ok {
+		t.Errorf("add() = (%v, %v), want (false, nil) without the annotation", ok, err)
+	}
+}
@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/cli-runtime/pkg/resource"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/utils/exec"
+	"sigs.k8s.io/kustomize/api/hasher"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+var (
+	verifyLong = `Verifies that the hash suffixes of ConfigMaps and Secrets match their content.
+
+Kustomize appends the hash of the content to the names of the generated ConfigMaps
+and Secrets, so that a change of the content results in a new name. The guarantee
+is broken if the content is edited afterwards, by hand in the cluster or in the
+rendered manifests. For each ConfigMap and Secret in the input having a real name
+and a hash suffixed name, the hash is computed again from the content of the local
+object and of the live object found by real name, and compared with the suffix.
+
+Exits with 1 if any suffix does not match the content.`
+
+	verifyExample = `  # Verify the hash suffixes of the rendered manifests and of the live objects
+  kustomize build ./example | kubectl realname-diff verify -f -`
+)
+
+// hashSuffixPattern matches the hash suffixes appended by Kustomize, which are
+// the first 10 hex digits of the hash with some of them replaced by letters.
+var hashSuffixPattern = regexp.MustCompile(`-([2456789bcdfghkmt]{10})$`)
+
+// hashSuffixStatuses are the statuses of the objects reported by the verify command.
+const (
+	hashSuffixStatusOK       = "ok"
+	hashSuffixStatusMismatch = "mismatch"
+)
+
+// contentHash returns the Kustomize hash of the content of the ConfigMap or Secret,
+// computed with the name without the hash suffix.
+func contentHash(obj *unstructured.Unstructured, name string) (string, error) {
+	obj = obj.DeepCopy()
+	obj.SetName(name)
+	node, err := yaml.FromMap(obj.Object)
+	if err != nil {
+		return "", err
+	}
+	return (&hasher.Hasher{}).Hash(node)
+}
+
+// verifyHashSuffix returns the hash suffix of the object and the one expected from
+// its content. checked is false if the object is not a ConfigMap nor a Secret with
+// a real name and a hash suffixed name.
+func verifyHashSuffix(obj *unstructured.Unstructured) (suffix, expected string, checked bool, err error) {
+	gvk := obj.GroupVersionKind()
+	if gvk.Group != "" || gvk.Version != "v1" || (gvk.Kind != "ConfigMap" && gvk.Kind != "Secret") {
+		return "", "", false, nil
+	}
+	if len(realName(obj)) == 0 {
+		return "", "", false, nil
+	}
+	match := hashSuffixPattern.FindStringSubmatchIndex(obj.GetName())
+	if match == nil {
+		return "", "", false, nil
+	}
+
+	name := obj.GetName()
+	suffix = name[match[2]:match[3]]
+	expected, err = contentHash(obj, name[:match[0]])
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to compute the hash of %s/%s: %v", gvk.Kind, name, err)
+	}
+	return suffix, expected, true, nil
+}
+
+// warnHashSuffix writes a warning if the hash suffix of the object does not match
+// its content. source tells where the object is from, "local" or "live".
+func warnHashSuffix(w io.Writer, obj *unstructured.Unstructured, source string) error {
+	suffix, expected, checked, err := verifyHashSuffix(obj)
+	if err != nil || !checked || suffix == expected {
+		return err
+	}
+	fmt.Fprintf(
+		w,
+		"Warning: the hash suffix of %s object (%v: %v) does not match its content, the content hash is %s\n",
+		source,
+		obj.GroupVersionKind(),
+		obj.GetName(),
+		expected,
+	)
+	return nil
+}
+
+func NewCmdVerify(streams genericclioptions.IOStreams) *cobra.Command {
+	options := NewVerifyOptions(streams)
+
+	configFlags := genericclioptions.NewConfigFlags(true)
+	factory := cmdutil.NewFactory(configFlags)
+
+	cmd := &cobra.Command{
+		Use:                   "verify -f FILENAME",
+		DisableFlagsInUseLine: true,
+		Short:                 "Verify that the hash suffixes of ConfigMaps and Secrets match their content.",
+		Long:                  verifyLong,
+		Example:               verifyExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckDiffErr(options.Complete(factory))
+			cmdutil.CheckDiffErr(validateArgs(cmd, args))
+
+			if err := options.Run(); err != nil {
+				if exitErr := diffError(err); exitErr != nil {
+					os.Exit(exitErr.ExitStatus())
+				}
+				cmdutil.CheckDiffErr(err)
+			}
+		},
+	}
+
+	configFlags.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&options.selector, "selector", "l", options.selector, "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.Flags().StringSliceVar(&options.matchLabels, "match-labels", options.matchLabels, "Label keys whose values must also match between the local and live objects when looking up by real name. (e.g. --match-labels app.kubernetes.io/instance)")
+	cmd.Flags().StringVar(&options.targetSelectionStrategy, "target-selection-strategy", targetSelectionStrategyError, "Specifies the behavior when multiple diff targets are found. The value must be either \"error\" or \"latest\". In \"latest\", the selection is based on \"metadata.creationTimestamp\"")
+	cmdutil.AddFilenameOptionFlags(cmd, &options.filenameOptions, "Contains the configuration to verify")
+
+	return cmd
+}
+
+type VerifyOptions struct {
+	filenameOptions resource.FilenameOptions
+
+	selector                string
+	matchLabels             []string
+	targetSelectionStrategy string
+
+	cmdNamespace     string
+	enforceNamespace bool
+	builder          *resource.Builder
+
+	genericclioptions.IOStreams
+}
+
+func NewVerifyOptions(streams genericclioptions.IOStreams) *VerifyOptions {
+	return &VerifyOptions{
+		IOStreams: streams,
+	}
+}
+
+func (o *VerifyOptions) Complete(factory cmdutil.Factory) error {
+	var err error
+
+	err = o.filenameOptions.RequireFilenameOrKustomize()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := targetSelectionStrategies[o.targetSelectionStrategy]; !ok {
+		return fmt.Errorf("--target-selection-strategy must be either \"error\" or \"latest\"")
+	}
+
+	o.cmdNamespace, o.enforceNamespace, err = factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return err
+	}
+
+	// Custom resources in the input are never verified, so their kinds need not be
+	// installed.
+	o.builder, _, err = newPendingKindBuilder(factory)
+	return err
+}
+
+// hashSuffixResult is the result of the verification of a hash suffix.
+type hashSuffixResult struct {
+	namespace string
+	kind      string
+	name      string
+	source    string
+	status    string
+
+	// expected is the hash computed from the content.
+	expected string
+}
+
+// verifyObject verifies the hash suffix of the object, and returns the result if it
+// is checked.
+func verifyObject(obj *unstructured.Unstructured, source string) (*hashSuffixResult, error) {
+	suffix, expected, checked, err := verifyHashSuffix(obj)
+	if err != nil || !checked {
+		return nil, err
+	}
+	result := &hashSuffixResult{
+		namespace: obj.GetNamespace(),
+		kind:      obj.GetKind(),
+		name:      obj.GetName(),
+		source:    source,
+		status:    hashSuffixStatusOK,
+		expected:  expected,
+	}
+	if suffix != expected {
+		result.status = hashSuffixStatusMismatch
+	}
+	return result, nil
+}
+
+func (o *VerifyOptions) Run() error {
+	lookup := &realnameLookup{
+		strategy:    o.targetSelectionStrategy,
+		matchLabels: o.matchLabels,
+		selector:    o.selector,
+	}
+
+	r := o.builder.
+		Unstructured().
+		NamespaceParam(o.cmdNamespace).DefaultNamespace().
+		FilenameParam(o.enforceNamespace, &o.filenameOptions).
+		LabelSelectorParam(o.selector).
+		Flatten().
+		Do()
+	if err := r.Err(); err != nil {
+		return err
+	}
+
+	var results []hashSuffixResult
+	err := r.Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		local := info.Object.(*unstructured.Unstructured).DeepCopy()
+		result, err := verifyObject(local, "local")
+		if err != nil || result == nil {
+			return err
+		}
+		results = append(results, *result)
+
+		err = lookup.getWithRealName(info, local, realName(local))
+		if isNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		result, err = verifyObject(info.Object.(*unstructured.Unstructured), "live")
+		if err != nil || result == nil {
+			return err
+		}
+		results = append(results, *result)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return printHashSuffixResults(o.Out, results)
+}
+
+// printHashSuffixResults prints the results, and returns an exit error with the
+// status 1 if any suffix does not match the content.
+func printHashSuffixResults(out io.Writer, results []hashSuffixResult) error {
+	w := printers.GetNewTabWriter(out)
+	fmt.Fprintln(w, "NAMESPACE\tKIND\tNAME\tSOURCE\tSTATUS\tCONTENT HASH")
+	var mismatched []string
+	for _, r := range results {
+		if r.status != hashSuffixStatusOK {
+			mismatched = append(mismatched, r.name)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.namespace, r.kind, r.name, r.source, r.status, r.expected)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(mismatched) > 0 {
+		return exec.CodeExitError{Err: fmt.Errorf("hash suffixes not matching the content: %s", strings.Join(mismatched, ", ")), Code: 1}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/utils/exec"
+)
+
+// Test_verifyHashSuffix tests computing the Kustomize hash from the content of ConfigMaps and Secrets
+func Test_verifyHashSuffix(t *testing.T) {
+	tests := []struct {
+		name             string
+		obj              func() *unstructured.Unstructured
+		expectedSuffix   string
+		expectedExpected string
+		expectedChecked  bool
+	}{
+		{
+			name: "ConfigMap generated by Kustomize",
+			obj: func() *unstructured.Unstructured {
+				return newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now())
+			},
+			expectedSuffix:   "bc58dhk76g",
+			expectedExpected: "bc58dhk76g",
+			expectedChecked:  true,
+		},
+		{
+			name: "ConfigMap edited after generated",
+			obj: func() *unstructured.Unstructured {
+				obj := newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now())
+				_ = unstructured.SetNestedField(obj.Object, "edited", "data", "test")
+				return obj
+			},
+			expectedSuffix:   "bc58dhk76g",
+			expectedExpected: "bct5bfcfmg",
+			expectedChecked:  true,
+		},
+		{
+			name: "Secret generated by Kustomize",
+			obj: func() *unstructured.Unstructured {
+				return &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Secret",
+					"metadata": map[string]interface{}{
+						"name":   "htpasswd-k7mbh9mm68",
+						"labels": map[string]interface{}{realNameLabel: "htpasswd"},
+					},
+					"type": "Opaque",
+					"data": map[string]interface{}{
+						".htpasswd": "dXNlcjokYXByMSRVWTRQb1QzTiR4LmEvWldRRExCblhKWThEVnJMeWkuCg==",
+					},
+				}}
+			},
+			expectedSuffix:   "k7mbh9mm68",
+			expectedExpected: "k7mbh9mm68",
+			expectedChecked:  true,
+		},
+		{
+			name: "without a hash suffix",
+			obj: func() *unstructured.Unstructured {
+				return newConfigMapWithRealname("nginx-conf", "nginx-conf", time.Now())
+			},
+		},
+		{
+			name: "without a real name",
+			obj: func() *unstructured.Unstructured {
+				obj := newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now())
+				obj.SetLabels(nil)
+				return obj
+			},
+		},
+		{
+			name: "other kinds",
+			obj: func() *unstructured.Unstructured {
+				obj := newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now())
+				obj.SetKind("Deployment")
+				obj.SetAPIVersion("apps/v1")
+				return obj
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suffix, expected, checked, err := verifyHashSuffix(tt.obj())
+			if err != nil {
+				t.Fatalf("verifyHashSuffix() returned error: %v", err)
+			}
+			if suffix != tt.expectedSuffix || expected != tt.expectedExpected || checked != tt.expectedChecked {
+				t.Errorf("verifyHashSuffix() = (%q, %q, %v), want (%q, %q, %v)",
+					suffix, expected, checked, tt.expectedSuffix, tt.expectedExpected, tt.expectedChecked)
+			}
+		})
+	}
+}
+
+// Test_warnHashSuffix tests warning only about the objects whose hash suffixes do not match the content
+func Test_warnHashSuffix(t *testing.T) {
+	var out bytes.Buffer
+	obj := newConfigMapWithRealname("nginx-conf-bc58dhk76g", "nginx-conf", time.Now())
+	if err := warnHashSuffix(&out, obj, "local"); err != nil || out.Len() != 0 {
+		t.Errorf("expected no warning, got %q (%v)", out.String(), err)
+	}
+
+	_ = unstructured.SetNestedField(obj.Object, "edited", "data", "test")
+	if err := warnHashSuffix(&out, obj, "live"); err != nil {
+		t.Fatalf("warnHashSuffix() returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "live object (/v1, Kind=ConfigMap: nginx-conf-bc58dhk76g)") {
+		t.Errorf("expected a warning about the live object, got %q", out.String())
+	}
+}
+
+// Test_printHashSuffixResults tests exiting with 1 if any suffix does not match the content
+func Test_printHashSuffixResults(t *testing.T) {
+	ok := hashSuffixResult{namespace: "default", kind: "ConfigMap", name: "nginx-conf-bc58dhk76g", source: "local", status: hashSuffixStatusOK, expected: "bc58dhk76g"}
+	mismatch := hashSuffixResult{namespace: "default", kind: "ConfigMap", name: "nginx-conf-bc58dhk76g", source: "live", status: hashSuffixStatusMismatch, expected: "bct5bfcfmg"}
+
+	var out bytes.Buffer
+	if err := printHashSuffixResults(&out, []hashSuffixResult{ok}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	out.Reset()
+	err := printHashSuffixResults(&out, []hashSuffixResult{ok, mismatch})
+	if exitErr, isExitErr := err.(exec.ExitError); !isExitErr || exitErr.ExitStatus() != 1 {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+	if !strings.Contains(out.String(), "live     mismatch   bct5bfcfmg") {
+		t.Errorf("expected the mismatch in the output, got:\n%s", out.String())
+	}
+}